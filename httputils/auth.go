@@ -0,0 +1,205 @@
+package httputils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTokenRefreshBefore is how long before its expiry a cached token is refreshed by default
+const DefaultTokenRefreshBefore = time.Minute
+
+// Token is an access token sent in the Authorization header
+type Token struct {
+	// AccessToken is the token itself
+	AccessToken string
+	// TokenType is the authorization scheme, empty means "Bearer"
+	TokenType string
+	// Expiry is the time the token expires, the zero value means it never expires
+	Expiry time.Time
+}
+
+// AuthorizationHeader returns the value of the Authorization header for the token
+func (t *Token) AuthorizationHeader() string {
+	tokenType := t.TokenType
+	if tokenType == "" {
+		tokenType = "Bearer"
+	}
+	return tokenType + " " + t.AccessToken
+}
+
+// expiresWithin returns true if the token expires in less than d after now
+func (t *Token) expiresWithin(now time.Time, d time.Duration) bool {
+	return !t.Expiry.IsZero() && !now.Add(d).Before(t.Expiry)
+}
+
+// TokenSource returns access tokens, implementations might fetch a new token on every call,
+// wrap them with NewCachingTokenSource to reuse a token until it expires
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenSourceFunc is an adapter to allow the use of ordinary functions as a TokenSource
+type TokenSourceFunc func(ctx context.Context) (*Token, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (*Token, error) {
+	return f(ctx)
+}
+
+// StaticTokenSource returns a TokenSource that always returns the same bearer token
+func StaticTokenSource(accessToken string) TokenSource {
+	token := &Token{AccessToken: accessToken}
+	return TokenSourceFunc(func(context.Context) (*Token, error) {
+		return token, nil
+	})
+}
+
+// CachingTokenSource reuses the token of another TokenSource until it is about to expire
+// a token is refreshed refreshBefore its expiry, if that refresh fails the cached token is used until it actually expires
+type CachingTokenSource struct {
+	source        TokenSource
+	refreshBefore time.Duration
+	mutex         sync.Mutex
+	token         *Token
+	refresh       *tokenRefresh
+	now           func() time.Time
+}
+
+// tokenRefresh is a refresh in progress, done is closed once token or err is set
+type tokenRefresh struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+var _ TokenSource = &CachingTokenSource{}
+
+// NewCachingTokenSource caches the tokens of source, a negative refreshBefore means DefaultTokenRefreshBefore
+func NewCachingTokenSource(source TokenSource, refreshBefore time.Duration) *CachingTokenSource {
+	if refreshBefore < 0 {
+		refreshBefore = DefaultTokenRefreshBefore
+	}
+	return &CachingTokenSource{
+		source:        source,
+		refreshBefore: refreshBefore,
+		now:           time.Now,
+	}
+}
+
+// Token returns the cached token, or a new token from the source if the cached one is missing or about to expire
+// concurrent callers wait for a single refresh, each of them until its own ctx is done
+// the refresh is not cancelled with the ctx of the caller that started it, the source is expected to bound its requests
+func (s *CachingTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mutex.Lock()
+	if s.token != nil && !s.token.expiresWithin(s.now(), s.refreshBefore) {
+		token := s.token
+		s.mutex.Unlock()
+		return token, nil
+	}
+	refresh := s.refresh
+	if refresh == nil {
+		refresh = &tokenRefresh{done: make(chan struct{})}
+		s.refresh = refresh
+		go s.doRefresh(context.WithoutCancel(ctx), refresh)
+	}
+	s.mutex.Unlock()
+
+	select {
+	case <-refresh.done:
+		return refresh.token, refresh.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// doRefresh gets a new token from the source and caches it, a failed refresh falls back to the unexpired cached token
+func (s *CachingTokenSource) doRefresh(ctx context.Context, refresh *tokenRefresh) {
+	token, err := s.source.Token(ctx)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err != nil {
+		if s.token != nil && !s.token.expiresWithin(s.now(), 0) {
+			token, err = s.token, nil
+		}
+	} else {
+		s.token = token
+	}
+	refresh.token, refresh.err = token, err
+	s.refresh = nil
+	close(refresh.done)
+}
+
+// Invalidate drops the cached token if it is still token, e.g. after the server rejected it,
+// so the next call to Token fetches a new one
+func (s *CachingTokenSource) Invalidate(token *Token) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.token == token {
+		s.token = nil
+	}
+}
+
+// cachedTokenSource is a TokenSource that caches its tokens, like CachingTokenSource and FileTokenSource
+type cachedTokenSource interface {
+	TokenSource
+	// Invalidate drops the cached token if it is still token
+	Invalidate(token *Token)
+}
+
+// BearerTokenMiddleware sets the Authorization header of every request to a token of source,
+// requests that already carry an Authorization header are left untouched
+// the tokens are cached with NewCachingTokenSource, unless source already caches them (i.e. it has an Invalidate method),
+// on a 401 response the token is refreshed once and the request is replayed if its body can be replayed (see http.Request.GetBody)
+func BearerTokenMiddleware(source TokenSource) Middleware {
+	cache, ok := source.(cachedTokenSource)
+	if !ok {
+		cache = NewCachingTokenSource(source, DefaultTokenRefreshBefore)
+	}
+	return func(next IHttpClient) IHttpClient {
+		return HttpClientFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Authorization") != "" {
+				return next.Do(req)
+			}
+			token, err := cache.Token(req.Context())
+			if err != nil {
+				closeRequestBody(req)
+				return nil, fmt.Errorf("failed to get access token: %w", err)
+			}
+			resp, err := next.Do(withAuthorization(req, token))
+			if err != nil || resp.StatusCode != http.StatusUnauthorized || !canReplay(req) {
+				return resp, err
+			}
+
+			cache.Invalidate(token)
+			newToken, tokenErr := cache.Token(req.Context())
+			if tokenErr != nil || newToken.AccessToken == token.AccessToken {
+				// replaying with the same token would be rejected again
+				return resp, nil
+			}
+			replay := withAuthorization(req, newToken)
+			if req.GetBody != nil {
+				if replay.Body, err = req.GetBody(); err != nil {
+					return resp, nil
+				}
+			}
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodySize))
+			_ = resp.Body.Close()
+			return next.Do(replay)
+		})
+	}
+}
+
+func withAuthorization(req *http.Request, token *Token) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", token.AuthorizationHeader())
+	return req
+}
+
+// canReplay returns true if the request can be sent again, i.e. it has no body or its body can be read again
+func canReplay(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
@@ -0,0 +1,214 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingTokenSource returns a new token on every call, valid for ttl
+type countingTokenSource struct {
+	mutex sync.Mutex
+	calls int
+	ttl   time.Duration
+	now   func() time.Time
+	err   error
+}
+
+func (s *countingTokenSource) Token(context.Context) (*Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.calls++
+	return &Token{AccessToken: "token-" + strconv.Itoa(s.calls), Expiry: s.now().Add(s.ttl)}, nil
+}
+
+func TestCachingTokenSource(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	source := &countingTokenSource{ttl: 10 * time.Minute, now: clock.Now}
+	cache := NewCachingTokenSource(source, time.Minute)
+	cache.now = clock.Now
+
+	token, err := cache.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", token.AccessToken)
+
+	t.Run("cached until the refresh window", func(t *testing.T) {
+		clock.now = clock.now.Add(8 * time.Minute)
+		token, err := cache.Token(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "token-1", token.AccessToken)
+	})
+
+	t.Run("refreshed proactively", func(t *testing.T) {
+		clock.now = clock.now.Add(90 * time.Second)
+		token, err := cache.Token(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "token-2", token.AccessToken)
+	})
+
+	t.Run("failed refresh falls back to the unexpired token", func(t *testing.T) {
+		source.err = errors.New("token endpoint is down")
+		clock.now = clock.now.Add(9*time.Minute + 30*time.Second)
+		token, err := cache.Token(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "token-2", token.AccessToken)
+
+		clock.now = clock.now.Add(time.Minute)
+		_, err = cache.Token(context.Background())
+		assert.ErrorIs(t, err, source.err)
+		source.err = nil
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		token, err := cache.Token(context.Background())
+		assert.NoError(t, err)
+		cache.Invalidate(&Token{AccessToken: token.AccessToken})
+		same, _ := cache.Token(context.Background())
+		assert.Same(t, token, same)
+
+		cache.Invalidate(token)
+		refreshed, _ := cache.Token(context.Background())
+		assert.NotEqual(t, token.AccessToken, refreshed.AccessToken)
+	})
+}
+
+func TestCachingTokenSourceConcurrentRefresh(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	cache := NewCachingTokenSource(TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		calls.Add(1)
+		<-release
+		return &Token{AccessToken: "token", Expiry: time.Now().Add(time.Hour)}, ctx.Err()
+	}), time.Minute)
+
+	// the caller starting the refresh gives up, the refresh goes on for the others
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, err := cache.Token(firstCtx)
+		firstErr <- err
+	}()
+	assert.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+	cancelFirst()
+	assert.ErrorIs(t, <-firstErr, context.Canceled)
+
+	t.Run("waiting caller returns when its context is done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := cache.Token(ctx)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("waiting callers share the refresh", func(t *testing.T) {
+		var wg sync.WaitGroup
+		tokens := make([]*Token, 5)
+		for i := range tokens {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				tokens[i], _ = cache.Token(context.Background())
+			}(i)
+		}
+		close(release)
+		wg.Wait()
+		for _, token := range tokens {
+			if assert.NotNil(t, token) {
+				assert.Equal(t, "token", token.AccessToken)
+			}
+		}
+		assert.Equal(t, int32(1), calls.Load())
+	})
+}
+
+func TestBearerTokenMiddleware(t *testing.T) {
+	newClient := func(valid func(auth string) bool, bodies *[]string) IHttpClient {
+		return &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				if req.Body != nil {
+					*bodies = append(*bodies, string(readRequestBody(req)))
+				}
+				if !valid(req.Header.Get("Authorization")) {
+					return &http.Response{StatusCode: http.StatusUnauthorized, Body: http.NoBody}, nil
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			},
+		}
+	}
+
+	t.Run("token is cached", func(t *testing.T) {
+		source := &countingTokenSource{ttl: time.Hour, now: time.Now}
+		var bodies []string
+		httpClient := Chain(newClient(func(auth string) bool { return auth == "Bearer token-1" }, &bodies), BearerTokenMiddleware(source))
+
+		for i := 0; i < 3; i++ {
+			resp, err := HttpGet(httpClient, "http://example.com", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+		assert.Equal(t, 1, source.calls)
+	})
+
+	t.Run("401 refreshes and replays the body once", func(t *testing.T) {
+		source := &countingTokenSource{ttl: time.Hour, now: time.Now}
+		var bodies []string
+		httpClient := Chain(newClient(func(auth string) bool { return auth == "Bearer token-2" }, &bodies), BearerTokenMiddleware(source))
+
+		resp, err := HttpPost(httpClient, "http://example.com", nil, []byte("payload"))
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, 2, source.calls)
+		assert.Equal(t, []string{"payload", "payload"}, bodies)
+	})
+
+	t.Run("401 with a rejected refreshed token is returned", func(t *testing.T) {
+		source := &countingTokenSource{ttl: time.Hour, now: time.Now}
+		var bodies []string
+		httpClient := Chain(newClient(func(string) bool { return false }, &bodies), BearerTokenMiddleware(source))
+
+		resp, err := HttpGetWithContext(context.Background(), httpClient, "http://example.com", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		assert.Equal(t, 2, source.calls)
+	})
+
+	t.Run("explicit authorization header is kept", func(t *testing.T) {
+		source := &countingTokenSource{ttl: time.Hour, now: time.Now}
+		var bodies []string
+		httpClient := Chain(newClient(func(auth string) bool { return auth == "Basic abc" }, &bodies), BearerTokenMiddleware(source))
+
+		resp, err := HttpGet(httpClient, "http://example.com", map[string]string{"Authorization": "Basic abc"})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, 0, source.calls)
+	})
+
+	t.Run("token source error", func(t *testing.T) {
+		source := &countingTokenSource{err: errors.New("no token")}
+		var bodies []string
+		httpClient := Chain(newClient(func(string) bool { return true }, &bodies), BearerTokenMiddleware(source))
+
+		body := &closeRecorder{Reader: strings.NewReader("payload")}
+		req, _ := http.NewRequest("POST", "http://example.com", body)
+		_, err := httpClient.Do(req)
+		assert.ErrorIs(t, err, source.err)
+		assert.True(t, body.closed)
+	})
+}
+
+func TestStaticTokenSource(t *testing.T) {
+	token, err := StaticTokenSource("abc").Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer abc", token.AuthorizationHeader())
+	assert.False(t, token.expiresWithin(time.Now(), time.Hour))
+}
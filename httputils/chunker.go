@@ -0,0 +1,189 @@
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+)
+
+// jsonArrayOverhead is the size of the brackets and the trailing new line JSONSize counts for a slice
+const jsonArrayOverhead = len("[]\n")
+
+// jsonArraySeparator is the size of the comma between two elements of a json array
+const jsonArraySeparator = len(",")
+
+// SizeFunc returns the size in bytes of an element once encoded
+type SizeFunc[T any] func(item T) (int, error)
+
+// JSONSizeFunc is the SizeFunc of the json encoding of an element of an array
+func JSONSizeFunc[T any](item T) (int, error) {
+	return jsonElementSize(item)
+}
+
+// ChunkerConfig configures a Chunker, a chunk is closed as soon as adding an element would exceed one of the limits
+type ChunkerConfig[T any] struct {
+	// MaxItems is the maximum number of elements in a chunk, 0 means unlimited
+	MaxItems int
+	// MaxBytes is the maximum encoded size of a chunk, 0 means unlimited
+	MaxBytes int
+	// SizeFunc returns the encoded size of an element, nil means JSONSizeFunc
+	SizeFunc SizeFunc[T]
+	// Overhead is the encoded size of an empty chunk, e.g. the array header,
+	// when SizeFunc is nil a zero Overhead means the json array overhead
+	Overhead int
+	// Separator is the encoded size of the separator between two elements,
+	// when SizeFunc is nil a zero Separator means the json comma
+	Separator int
+	// CompressionRatio, when set, makes MaxBytes a limit on the estimated compressed size of a chunk,
+	// i.e. its encoded size multiplied by the ratio (see EstimateJSONCompressionRatio)
+	// the ratio is only an estimate, the actual compressed size of a chunk can exceed MaxBytes,
+	// when the endpoint enforces a hard limit on the compressed size keep a safety margin, e.g. set MaxBytes below that limit
+	CompressionRatio float64
+}
+
+// Chunker splits slices to chunks bounded by a number of elements and an encoded size
+// Chunks might be bigger than MaxBytes if the slice contains element(s) that are bigger than MaxBytes
+type Chunker[T any] struct {
+	packer chunkPacker[T]
+}
+
+// NewChunker returns a Chunker for the given limits
+func NewChunker[T any](config ChunkerConfig[T]) *Chunker[T] {
+	packer := chunkPacker[T]{
+		maxItems:  config.MaxItems,
+		maxBytes:  config.MaxBytes,
+		sizeOf:    config.SizeFunc,
+		overhead:  config.Overhead,
+		separator: config.Separator,
+	}
+	if packer.maxItems <= 0 {
+		packer.maxItems = math.MaxInt
+	}
+	if packer.maxBytes <= 0 {
+		packer.maxBytes = math.MaxInt
+	} else if config.CompressionRatio > 0 {
+		// bounding the compressed size is the same as bounding the encoded size by MaxBytes / ratio
+		packer.maxBytes = int(math.Min(float64(packer.maxBytes)/config.CompressionRatio, math.MaxInt))
+	}
+	if packer.sizeOf == nil {
+		packer.sizeOf = JSONSizeFunc[T]
+		if packer.overhead == 0 {
+			packer.overhead = jsonArrayOverhead
+		}
+		if packer.separator == 0 {
+			packer.separator = jsonArraySeparator
+		}
+	}
+	return &Chunker[T]{packer: packer}
+}
+
+// Split returns the chunks of slice in the original order, or the first error returned by the SizeFunc
+func (c *Chunker[T]) Split(slice []T) ([][]T, error) {
+	var chunks [][]T
+	err := c.packer.pack(slice, func(start, end int) error {
+		chunks = append(chunks, slice[start:end])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// SplitToChannel sends the chunks of slice in the original order to the returned chunks channel
+// splitting stops as soon as ctx is done or the SizeFunc returns an error, the chunks channel is then closed
+// The errors channel receives at most one error (the SizeFunc error or the context error),
+// it is closed after the chunks channel is closed
+func (c *Chunker[T]) SplitToChannel(ctx context.Context, slice []T, channelBuffer int) (chunksChannel <-chan []T, errChannel <-chan error) {
+	channel := make(chan []T, channelBuffer)
+	errs := make(chan error, 1)
+	go func(chunksChannel chan<- []T) {
+		defer close(errs)
+		err := c.packer.pack(slice, func(start, end int) error {
+			select {
+			case chunksChannel <- slice[start:end]:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err == nil {
+			err = ctx.Err()
+		}
+		close(chunksChannel)
+		if err != nil {
+			errs <- err
+		}
+	}(channel)
+	return channel, errs
+}
+
+// SplitSlice2ChunksBySize - splits a slice to chunks of sub slices whose JSONSize does not exceed max bytes size
+// every element is encoded once and the chunks are packed greedily in the original slice order,
+// so the work is linear in the size of the slice
+// Chunks might be bigger than max size if the slice contains element(s) that are bigger than the max size
+// Returns an error if an element cannot be encoded to json
+func SplitSlice2ChunksBySize[T any](slice []T, maxSize int) ([][]T, error) {
+	chunker := &Chunker[T]{packer: jsonChunkPacker[T](maxSize)}
+	return chunker.Split(slice)
+}
+
+// chunkPacker packs consecutive elements greedily into chunks, all the limits are enforced
+type chunkPacker[T any] struct {
+	maxItems  int
+	maxBytes  int
+	sizeOf    SizeFunc[T]
+	overhead  int
+	separator int
+}
+
+// jsonChunkPacker returns the packer of chunks whose JSONSize does not exceed maxSize
+func jsonChunkPacker[T any](maxSize int) chunkPacker[T] {
+	return chunkPacker[T]{
+		maxItems:  math.MaxInt,
+		maxBytes:  maxSize,
+		sizeOf:    JSONSizeFunc[T],
+		overhead:  jsonArrayOverhead,
+		separator: jsonArraySeparator,
+	}
+}
+
+// pack calls emit with the boundaries of every chunk of slice, stopping at the first error
+// every element is measured once
+func (p chunkPacker[T]) pack(slice []T, emit func(start, end int) error) error {
+	if len(slice) == 0 {
+		return nil
+	}
+	start := 0
+	size := p.overhead
+	for i := range slice {
+		elementSize, err := p.sizeOf(slice[i])
+		if err != nil {
+			return err
+		}
+		if i > start {
+			if i-start >= p.maxItems || size+p.separator+elementSize > p.maxBytes {
+				if err := emit(start, i); err != nil {
+					return err
+				}
+				start = i
+				size = p.overhead
+			} else {
+				size += p.separator
+			}
+		}
+		size += elementSize
+	}
+	return emit(start, len(slice))
+}
+
+// jsonElementSize returns the size in bytes of the json encoding of v as an element of an array
+func jsonElementSize(v interface{}) (int, error) {
+	counter := bytesCounter{}
+	enc := json.NewEncoder(&counter)
+	if err := enc.Encode(v); err != nil {
+		return 0, err
+	}
+	// the encoder terminates each value with a new line
+	return counter.count - 1, nil
+}
@@ -0,0 +1,176 @@
+package httputils
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type chunkerTestStruct struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Score       float64  `json:"score"`
+	Links       []string `json:"links,omitempty"`
+}
+
+func newChunkerTestSlice(n int) []chunkerTestStruct {
+	slice := make([]chunkerTestStruct, n)
+	for i := range slice {
+		slice[i] = chunkerTestStruct{
+			Name:        fmt.Sprintf("CVE-2022-%d", i),
+			Description: strings.Repeat("<desc>", i%13),
+			Score:       float64(i%100) / 10,
+			Links:       make([]string, i%3),
+		}
+	}
+	return slice
+}
+
+func TestSplitSlice2ChunksBySize(t *testing.T) {
+	slice := newChunkerTestSlice(500)
+
+	for _, maxSize := range []int{1, 50, 100, 1000, 100000} {
+		t.Run(fmt.Sprintf("max size %d", maxSize), func(t *testing.T) {
+			chunks, err := SplitSlice2ChunksBySize(slice, maxSize)
+			assert.NoError(t, err)
+
+			total := 0
+			for i, chunk := range chunks {
+				assert.NotEmpty(t, chunk)
+				if len(chunk) > 1 {
+					assert.LessOrEqual(t, JSONSize(chunk), maxSize)
+				}
+				// chunks are packed greedily
+				if i < len(chunks)-1 {
+					assert.Greater(t, JSONSize(slice[total:total+len(chunk)+1]), maxSize)
+				}
+				assert.Equal(t, slice[total:total+len(chunk)], chunk)
+				total += len(chunk)
+			}
+			assert.Equal(t, len(slice), total)
+		})
+	}
+
+	t.Run("empty slice", func(t *testing.T) {
+		chunks, err := SplitSlice2ChunksBySize([]chunkerTestStruct{}, 100)
+		assert.NoError(t, err)
+		assert.Empty(t, chunks)
+	})
+
+	t.Run("nil elements", func(t *testing.T) {
+		slice := []interface{}{nil, "a", nil, nil, 1}
+		chunks, err := SplitSlice2ChunksBySize(slice, JSONSize(slice[:3]))
+		assert.NoError(t, err)
+		assert.Equal(t, [][]interface{}{slice[:3], slice[3:]}, chunks)
+	})
+
+	t.Run("encoding error", func(t *testing.T) {
+		invalid := newChunkerTestSlice(10)
+		invalid[5].Score = math.NaN()
+		_, err := SplitSlice2ChunksBySize(invalid, 100)
+		assert.Error(t, err)
+	})
+}
+
+func BenchmarkSplitSlice2Chunks(b *testing.B) {
+	slice := newChunkerTestSlice(5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		chunks, _ := SplitSlice2Chunks(slice, 64*1024, 10)
+		for range chunks {
+		}
+	}
+}
+
+func BenchmarkSplitSlice2ChunksBySize(b *testing.B) {
+	slice := newChunkerTestSlice(5000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = SplitSlice2ChunksBySize(slice, 64*1024)
+	}
+}
+
+func TestChunker(t *testing.T) {
+	slice := newChunkerTestSlice(100)
+
+	t.Run("max items", func(t *testing.T) {
+		chunks, err := NewChunker(ChunkerConfig[chunkerTestStruct]{MaxItems: 30}).Split(slice)
+		assert.NoError(t, err)
+		assert.Equal(t, [][]chunkerTestStruct{slice[:30], slice[30:60], slice[60:90], slice[90:]}, chunks)
+	})
+
+	t.Run("max items and max bytes", func(t *testing.T) {
+		chunks, err := NewChunker(ChunkerConfig[chunkerTestStruct]{MaxItems: 5, MaxBytes: 500}).Split(slice)
+		assert.NoError(t, err)
+		total := 0
+		for _, chunk := range chunks {
+			assert.LessOrEqual(t, len(chunk), 5)
+			assert.LessOrEqual(t, JSONSize(chunk), 500)
+			total += len(chunk)
+		}
+		assert.Equal(t, len(slice), total)
+	})
+
+	t.Run("same chunks as SplitSlice2ChunksBySize", func(t *testing.T) {
+		expected, err := SplitSlice2ChunksBySize(slice, 1000)
+		assert.NoError(t, err)
+		chunks, err := NewChunker(ChunkerConfig[chunkerTestStruct]{MaxBytes: 1000}).Split(slice)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, chunks)
+	})
+
+	t.Run("custom size function", func(t *testing.T) {
+		// every element takes 10 bytes, with a 2 bytes header per chunk and no separator
+		chunker := NewChunker(ChunkerConfig[string]{
+			MaxBytes: 32,
+			SizeFunc: func(item string) (int, error) {
+				return 10, nil
+			},
+			Overhead: 2,
+		})
+		chunks, err := chunker.Split([]string{"a", "b", "c", "d", "e", "f", "g"})
+		assert.NoError(t, err)
+		assert.Equal(t, [][]string{{"a", "b", "c"}, {"d", "e", "f"}, {"g"}}, chunks)
+	})
+
+	t.Run("size function error", func(t *testing.T) {
+		chunker := NewChunker(ChunkerConfig[string]{
+			SizeFunc: func(item string) (int, error) {
+				return 0, fmt.Errorf("cannot encode %s", item)
+			},
+		})
+		_, err := chunker.Split([]string{"a"})
+		assert.EqualError(t, err, "cannot encode a")
+
+		chunksChan, errChan := chunker.SplitToChannel(context.Background(), []string{"a"}, 0)
+		for range chunksChan {
+		}
+		assert.EqualError(t, <-errChan, "cannot encode a")
+	})
+
+	t.Run("channel", func(t *testing.T) {
+		chunker := NewChunker(ChunkerConfig[chunkerTestStruct]{MaxItems: 7, MaxBytes: 1000})
+		expected, err := chunker.Split(slice)
+		assert.NoError(t, err)
+
+		chunksChan, errChan := chunker.SplitToChannel(context.Background(), slice, 0)
+		var chunks [][]chunkerTestStruct
+		for chunk := range chunksChan {
+			chunks = append(chunks, chunk)
+		}
+		assert.NoError(t, <-errChan)
+		assert.Equal(t, expected, chunks)
+	})
+
+	t.Run("channel cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		chunksChan, errChan := NewChunker(ChunkerConfig[chunkerTestStruct]{MaxItems: 1}).SplitToChannel(ctx, slice, 0)
+		<-chunksChan
+		cancel()
+		assert.ErrorIs(t, <-errChan, context.Canceled)
+	})
+}
@@ -0,0 +1,289 @@
+package httputils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned (wrapped with the host name) when a request is rejected by an open circuit breaker
+// the retry engine never retries it
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets all the requests through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects all the requests until the open timeout expires
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe requests through
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("unknown(%d)", int(s))
+}
+
+// CircuitBreakerConfig configures a CircuitBreaker
+type CircuitBreakerConfig struct {
+	// ConsecutiveFailures opens the circuit after this number of consecutive failures, 0 disables this threshold
+	ConsecutiveFailures int
+	// FailureRatio opens the circuit when the ratio of failed requests reaches it, 0 disables this threshold
+	FailureRatio float64
+	// MinRequests is the number of requests needed in the current interval before FailureRatio is evaluated
+	MinRequests int
+	// Interval is the period after which the counters of a closed circuit are cleared, 0 never clears them
+	Interval time.Duration
+	// OpenTimeout is the time an open circuit waits before turning half-open
+	OpenTimeout time.Duration
+	// HalfOpenMaxRequests is the number of probe requests allowed in the half-open state,
+	// the circuit closes once all of them succeed and opens again on the first failure
+	HalfOpenMaxRequests int
+	// PerHost keeps a separate circuit for every host instead of a single one for the client
+	PerHost bool
+	// IsFailure decides whether a request failed, nil means transport errors, 429 and 5xx responses
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange is called on every state transition, host is empty when PerHost is false
+	OnStateChange func(host string, from, to CircuitState)
+}
+
+// DefaultCircuitBreakerConfig returns a per-host configuration that opens after 5 consecutive failures
+// or when half of at least 10 requests fail within a minute, and probes again after 30 seconds
+func DefaultCircuitBreakerConfig() *CircuitBreakerConfig {
+	return &CircuitBreakerConfig{
+		ConsecutiveFailures: 5,
+		FailureRatio:        0.5,
+		MinRequests:         10,
+		Interval:            time.Minute,
+		OpenTimeout:         30 * time.Second,
+		HalfOpenMaxRequests: 1,
+		PerHost:             true,
+	}
+}
+
+func defaultIsFailure(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// CircuitBreaker is an IHttpClient that stops sending requests to a failing backend
+type CircuitBreaker struct {
+	httpClient IHttpClient
+	config     CircuitBreakerConfig
+	mutex      sync.Mutex
+	circuits   map[string]*circuit
+	now        func() time.Time
+}
+
+var _ IHttpClient = &CircuitBreaker{}
+
+// NewCircuitBreaker wraps httpClient with a circuit breaker, a nil config means DefaultCircuitBreakerConfig
+func NewCircuitBreaker(httpClient IHttpClient, config *CircuitBreakerConfig) *CircuitBreaker {
+	if config == nil {
+		config = DefaultCircuitBreakerConfig()
+	}
+	cb := &CircuitBreaker{
+		httpClient: httpClient,
+		config:     *config,
+		circuits:   map[string]*circuit{},
+		now:        time.Now,
+	}
+	if cb.config.HalfOpenMaxRequests <= 0 {
+		cb.config.HalfOpenMaxRequests = 1
+	}
+	if cb.config.IsFailure == nil {
+		cb.config.IsFailure = defaultIsFailure
+	}
+	return cb
+}
+
+// CircuitBreakerMiddleware returns a Middleware wrapping the client with NewCircuitBreaker
+func CircuitBreakerMiddleware(config *CircuitBreakerConfig) Middleware {
+	return func(next IHttpClient) IHttpClient {
+		return NewCircuitBreaker(next, config)
+	}
+}
+
+func (cb *CircuitBreaker) Do(req *http.Request) (*http.Response, error) {
+	host := cb.hostOf(req)
+	generation, err := cb.before(host)
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+	resp, err := cb.httpClient.Do(req)
+	cb.after(host, generation, cb.config.IsFailure(resp, err))
+	return resp, err
+}
+
+// State returns the current state of the circuit of host (ignored when PerHost is false)
+func (cb *CircuitBreaker) State(host string) CircuitState {
+	if !cb.config.PerHost {
+		host = ""
+	}
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	c, ok := cb.circuits[host]
+	if !ok {
+		return CircuitClosed
+	}
+	notify := cb.refresh(host, c)
+	defer notify()
+	return c.state
+}
+
+func (cb *CircuitBreaker) hostOf(req *http.Request) string {
+	if cb.config.PerHost && req.URL != nil {
+		return req.URL.Host
+	}
+	return ""
+}
+
+// circuit holds the state and counters of a single circuit
+type circuit struct {
+	state               CircuitState
+	generation          uint64
+	expiry              time.Time
+	requests            int
+	failures            int
+	consecutiveFailures int
+	halfOpenRequests    int
+	halfOpenSuccesses   int
+}
+
+// before checks whether the request is allowed and returns the circuit generation it belongs to
+func (cb *CircuitBreaker) before(host string) (uint64, error) {
+	cb.mutex.Lock()
+	c, ok := cb.circuits[host]
+	if !ok {
+		c = &circuit{}
+		cb.setExpiry(c)
+		cb.circuits[host] = c
+	}
+	notify := cb.refresh(host, c)
+	var err error
+	switch c.state {
+	case CircuitOpen:
+		err = fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+	case CircuitHalfOpen:
+		if c.halfOpenRequests >= cb.config.HalfOpenMaxRequests {
+			err = fmt.Errorf("%w: %s (half-open)", ErrCircuitOpen, host)
+		} else {
+			c.halfOpenRequests++
+		}
+	}
+	generation := c.generation
+	cb.mutex.Unlock()
+	notify()
+	return generation, err
+}
+
+// after records the outcome of a request, outcomes of a previous generation are ignored
+func (cb *CircuitBreaker) after(host string, generation uint64, failure bool) {
+	cb.mutex.Lock()
+	c := cb.circuits[host]
+	notify := cb.refresh(host, c)
+	if generation == c.generation {
+		switch c.state {
+		case CircuitClosed:
+			c.requests++
+			if failure {
+				c.failures++
+				c.consecutiveFailures++
+				if cb.shouldTrip(c) {
+					notify = chainNotify(notify, cb.setState(host, c, CircuitOpen))
+				}
+			} else {
+				c.consecutiveFailures = 0
+			}
+		case CircuitHalfOpen:
+			if failure {
+				notify = chainNotify(notify, cb.setState(host, c, CircuitOpen))
+			} else {
+				c.halfOpenSuccesses++
+				if c.halfOpenSuccesses >= cb.config.HalfOpenMaxRequests {
+					notify = chainNotify(notify, cb.setState(host, c, CircuitClosed))
+				}
+			}
+		}
+	}
+	cb.mutex.Unlock()
+	notify()
+}
+
+func (cb *CircuitBreaker) shouldTrip(c *circuit) bool {
+	if cb.config.ConsecutiveFailures > 0 && c.consecutiveFailures >= cb.config.ConsecutiveFailures {
+		return true
+	}
+	return cb.config.FailureRatio > 0 && c.requests >= cb.config.MinRequests &&
+		float64(c.failures)/float64(c.requests) >= cb.config.FailureRatio
+}
+
+// refresh applies the time based transitions, it must be called with the mutex held
+// the returned function calls OnStateChange and must be called after the mutex is released
+func (cb *CircuitBreaker) refresh(host string, c *circuit) func() {
+	now := cb.now()
+	switch c.state {
+	case CircuitClosed:
+		if !c.expiry.IsZero() && now.After(c.expiry) {
+			cb.resetCounters(c)
+			cb.setExpiry(c)
+		}
+	case CircuitOpen:
+		if now.After(c.expiry) {
+			return cb.setState(host, c, CircuitHalfOpen)
+		}
+	}
+	return func() {}
+}
+
+// setState moves the circuit to a new generation in the given state, it must be called with the mutex held
+func (cb *CircuitBreaker) setState(host string, c *circuit, state CircuitState) func() {
+	from := c.state
+	c.state = state
+	c.generation++
+	cb.resetCounters(c)
+	cb.setExpiry(c)
+	return func() {
+		if cb.config.OnStateChange != nil {
+			cb.config.OnStateChange(host, from, state)
+		}
+	}
+}
+
+func (cb *CircuitBreaker) resetCounters(c *circuit) {
+	c.requests = 0
+	c.failures = 0
+	c.consecutiveFailures = 0
+	c.halfOpenRequests = 0
+	c.halfOpenSuccesses = 0
+}
+
+func (cb *CircuitBreaker) setExpiry(c *circuit) {
+	switch {
+	case c.state == CircuitOpen:
+		c.expiry = cb.now().Add(cb.config.OpenTimeout)
+	case c.state == CircuitClosed && cb.config.Interval > 0:
+		c.expiry = cb.now().Add(cb.config.Interval)
+	default:
+		c.expiry = time.Time{}
+	}
+}
+
+func chainNotify(first, second func()) func() {
+	return func() {
+		first()
+		second()
+	}
+}
@@ -0,0 +1,171 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func newTestCircuitBreaker(httpClient IHttpClient, config *CircuitBreakerConfig) (*CircuitBreaker, *fakeClock) {
+	clock := &fakeClock{now: time.Now()}
+	cb := NewCircuitBreaker(httpClient, config)
+	cb.now = clock.Now
+	return cb, clock
+}
+
+func TestCircuitBreakerConsecutiveFailures(t *testing.T) {
+	failing := true
+	httpClient := &mockHttpClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			if failing {
+				return &http.Response{StatusCode: http.StatusBadGateway, Body: http.NoBody}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		},
+	}
+	type transition struct {
+		host     string
+		from, to CircuitState
+	}
+	var transitions []transition
+	config := &CircuitBreakerConfig{
+		ConsecutiveFailures: 3,
+		OpenTimeout:         time.Minute,
+		HalfOpenMaxRequests: 2,
+		PerHost:             true,
+		OnStateChange: func(host string, from, to CircuitState) {
+			transitions = append(transitions, transition{host, from, to})
+		},
+	}
+	cb, clock := newTestCircuitBreaker(httpClient, config)
+
+	for i := 0; i < 3; i++ {
+		_, err := HttpGet(cb, "http://a.example.com", nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, CircuitOpen, cb.State("a.example.com"))
+	assert.Equal(t, CircuitClosed, cb.State("b.example.com"))
+
+	// open circuit fails fast
+	_, err := HttpGet(cb, "http://a.example.com", nil)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	// other hosts are not affected
+	_, err = HttpGet(cb, "http://b.example.com", nil)
+	assert.NoError(t, err)
+
+	// half-open after the timeout, a failed probe opens the circuit again
+	clock.now = clock.now.Add(2 * time.Minute)
+	assert.Equal(t, CircuitHalfOpen, cb.State("a.example.com"))
+	_, err = HttpGet(cb, "http://a.example.com", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, CircuitOpen, cb.State("a.example.com"))
+
+	// successful probes close the circuit
+	failing = false
+	clock.now = clock.now.Add(2 * time.Minute)
+	for i := 0; i < 2; i++ {
+		_, err = HttpGet(cb, "http://a.example.com", nil)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, CircuitClosed, cb.State("a.example.com"))
+
+	assert.Equal(t, []transition{
+		{"a.example.com", CircuitClosed, CircuitOpen},
+		{"a.example.com", CircuitOpen, CircuitHalfOpen},
+		{"a.example.com", CircuitHalfOpen, CircuitOpen},
+		{"a.example.com", CircuitOpen, CircuitHalfOpen},
+		{"a.example.com", CircuitHalfOpen, CircuitClosed},
+	}, transitions)
+}
+
+func TestCircuitBreakerFailureRatio(t *testing.T) {
+	count := 0
+	httpClient := &mockHttpClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			count++
+			if count%2 == 0 {
+				return nil, fmt.Errorf("connection reset")
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		},
+	}
+	config := &CircuitBreakerConfig{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		Interval:     time.Minute,
+		OpenTimeout:  time.Minute,
+	}
+	cb, clock := newTestCircuitBreaker(httpClient, config)
+
+	for i := 0; i < 3; i++ {
+		_, _ = HttpGet(cb, "http://example.com", nil)
+	}
+	assert.Equal(t, CircuitClosed, cb.State(""))
+
+	// counters are cleared after the interval
+	clock.now = clock.now.Add(2 * time.Minute)
+	for i := 0; i < 3; i++ {
+		_, _ = HttpGet(cb, "http://example.com", nil)
+	}
+	assert.Equal(t, CircuitClosed, cb.State(""))
+	_, _ = HttpGet(cb, "http://example.com", nil)
+	assert.Equal(t, CircuitClosed, cb.State(""))
+	_, _ = HttpGet(cb, "http://example.com", nil)
+	assert.Equal(t, CircuitOpen, cb.State(""))
+}
+
+func TestCircuitBreakerIsNotRetried(t *testing.T) {
+	retryCount := 0
+	httpClient := &mockHttpClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			retryCount++
+			return nil, fmt.Errorf("connection refused")
+		},
+	}
+	config := DefaultCircuitBreakerConfig()
+	config.ConsecutiveFailures = 2
+	chained := Chain(httpClient, CircuitBreakerMiddleware(config))
+
+	_, err := HttpGetWithPolicy(context.Background(), chained, "http://example.com", nil, fastRetryPolicy())
+
+	assert.True(t, errors.Is(err, ErrCircuitOpen))
+	assert.Equal(t, 2, retryCount)
+}
+
+func TestCircuitBreakerClosesRejectedBody(t *testing.T) {
+	httpClient := &mockHttpClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			return nil, fmt.Errorf("connection refused")
+		},
+	}
+	cb, _ := newTestCircuitBreaker(httpClient, &CircuitBreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Minute})
+	_, _ = HttpGet(cb, "http://example.com", nil)
+	assert.Equal(t, CircuitOpen, cb.State(""))
+
+	body := &closeRecorder{Reader: strings.NewReader("payload")}
+	req, _ := http.NewRequest("POST", "http://example.com", body)
+	_, err := cb.Do(req)
+
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.True(t, body.closed)
+}
+
+func TestCircuitStateString(t *testing.T) {
+	assert.Equal(t, "closed", CircuitClosed.String())
+	assert.Equal(t, "open", CircuitOpen.String())
+	assert.Equal(t, "half-open", CircuitHalfOpen.String())
+}
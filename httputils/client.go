@@ -0,0 +1,184 @@
+package httputils
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Default settings of the transport of NewClient
+const (
+	DefaultDialTimeout           = 10 * time.Second
+	DefaultKeepAlive             = 30 * time.Second
+	DefaultTLSHandshakeTimeout   = 10 * time.Second
+	DefaultResponseHeaderTimeout = 30 * time.Second
+	DefaultIdleConnTimeout       = 90 * time.Second
+	DefaultExpectContinueTimeout = time.Second
+	DefaultMaxIdleConns          = 100
+	DefaultMaxIdleConnsPerHost   = 10
+)
+
+// ClientOption configures the client returned by NewClient
+type ClientOption func(options *clientOptions)
+
+type clientOptions struct {
+	timeout               time.Duration
+	dialTimeout           time.Duration
+	keepAlive             time.Duration
+	tlsHandshakeTimeout   time.Duration
+	responseHeaderTimeout time.Duration
+	idleConnTimeout       time.Duration
+	maxIdleConns          int
+	maxIdleConnsPerHost   int
+	maxConnsPerHost       int
+	http2                 bool
+	proxy                 func(req *http.Request) (*url.URL, error)
+	tlsConfig             *tls.Config
+	middlewares           []Middleware
+}
+
+// WithTimeout limits the whole exchange of a request, response body included, 0 (the default) means no limit
+// prefer a context deadline for long streamed bodies
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithDialTimeout limits the time to establish a TCP connection, DefaultDialTimeout by default
+func WithDialTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithKeepAlive sets the TCP keep-alive period, DefaultKeepAlive by default
+func WithKeepAlive(keepAlive time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.keepAlive = keepAlive
+	}
+}
+
+// WithTLSHandshakeTimeout limits the time of the TLS handshake, DefaultTLSHandshakeTimeout by default
+func WithTLSHandshakeTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.tlsHandshakeTimeout = timeout
+	}
+}
+
+// WithResponseHeaderTimeout limits the time to wait for the response headers once the request is written,
+// DefaultResponseHeaderTimeout by default
+func WithResponseHeaderTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.responseHeaderTimeout = timeout
+	}
+}
+
+// WithIdleConnTimeout sets the time an idle connection is kept in the pool, DefaultIdleConnTimeout by default
+func WithIdleConnTimeout(timeout time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.idleConnTimeout = timeout
+	}
+}
+
+// WithMaxIdleConns sets the maximum number of idle connections of the pool, DefaultMaxIdleConns by default
+func WithMaxIdleConns(n int) ClientOption {
+	return func(o *clientOptions) {
+		o.maxIdleConns = n
+	}
+}
+
+// WithMaxIdleConnsPerHost sets the maximum number of idle connections kept per host, DefaultMaxIdleConnsPerHost by default
+func WithMaxIdleConnsPerHost(n int) ClientOption {
+	return func(o *clientOptions) {
+		o.maxIdleConnsPerHost = n
+	}
+}
+
+// WithMaxConnsPerHost limits the number of connections per host, 0 (the default) means no limit
+func WithMaxConnsPerHost(n int) ClientOption {
+	return func(o *clientOptions) {
+		o.maxConnsPerHost = n
+	}
+}
+
+// WithHTTP2 enables or disables HTTP/2, it is enabled by default
+func WithHTTP2(enabled bool) ClientOption {
+	return func(o *clientOptions) {
+		o.http2 = enabled
+	}
+}
+
+// WithProxy sets the proxy function of the transport, http.ProxyFromEnvironment by default, nil disables the proxy
+func WithProxy(proxy func(req *http.Request) (*url.URL, error)) ClientOption {
+	return func(o *clientOptions) {
+		o.proxy = proxy
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of the transport, e.g. one returned by NewTLSConfig
+func WithTLSConfig(tlsConfig *tls.Config) ClientOption {
+	return func(o *clientOptions) {
+		o.tlsConfig = tlsConfig
+	}
+}
+
+// WithMiddlewares wraps the client with the middlewares, see Chain
+func WithMiddlewares(middlewares ...Middleware) ClientOption {
+	return func(o *clientOptions) {
+		o.middlewares = append(o.middlewares, middlewares...)
+	}
+}
+
+// NewClient returns the recommended IHttpClient for the helpers of this package, unlike http.DefaultClient
+// it has explicit dial, TLS handshake, response header and idle timeouts, a bounded connection pool,
+// HTTP/2 enabled and the proxy taken from the environment (HTTP_PROXY, HTTPS_PROXY and NO_PROXY)
+// create it once and share it, the connections are pooled by the client
+func NewClient(opts ...ClientOption) IHttpClient {
+	options := &clientOptions{
+		dialTimeout:           DefaultDialTimeout,
+		keepAlive:             DefaultKeepAlive,
+		tlsHandshakeTimeout:   DefaultTLSHandshakeTimeout,
+		responseHeaderTimeout: DefaultResponseHeaderTimeout,
+		idleConnTimeout:       DefaultIdleConnTimeout,
+		maxIdleConns:          DefaultMaxIdleConns,
+		maxIdleConnsPerHost:   DefaultMaxIdleConnsPerHost,
+		http2:                 true,
+		proxy:                 http.ProxyFromEnvironment,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return Chain(&http.Client{
+		Transport: newTransport(options),
+		Timeout:   options.timeout,
+	}, options.middlewares...)
+}
+
+func newTransport(options *clientOptions) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   options.dialTimeout,
+		KeepAlive: options.keepAlive,
+	}
+	transport := &http.Transport{
+		Proxy:                 options.proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       options.tlsConfig,
+		TLSHandshakeTimeout:   options.tlsHandshakeTimeout,
+		ResponseHeaderTimeout: options.responseHeaderTimeout,
+		IdleConnTimeout:       options.idleConnTimeout,
+		ExpectContinueTimeout: DefaultExpectContinueTimeout,
+		MaxIdleConns:          options.maxIdleConns,
+		MaxIdleConnsPerHost:   options.maxIdleConnsPerHost,
+		MaxConnsPerHost:       options.maxConnsPerHost,
+		// a custom dialer or TLS configuration disables HTTP/2 unless it is forced
+		ForceAttemptHTTP2: options.http2,
+	}
+	if !options.http2 {
+		// a non nil empty map disables HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
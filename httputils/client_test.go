@@ -0,0 +1,106 @@
+package httputils
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClientDefaults(t *testing.T) {
+	httpClient, ok := NewClient().(*http.Client)
+	require.True(t, ok)
+	transport, ok := httpClient.Transport.(*http.Transport)
+	require.True(t, ok)
+
+	assert.Zero(t, httpClient.Timeout)
+	assert.Equal(t, DefaultTLSHandshakeTimeout, transport.TLSHandshakeTimeout)
+	assert.Equal(t, DefaultResponseHeaderTimeout, transport.ResponseHeaderTimeout)
+	assert.Equal(t, DefaultIdleConnTimeout, transport.IdleConnTimeout)
+	assert.Equal(t, DefaultMaxIdleConns, transport.MaxIdleConns)
+	assert.Equal(t, DefaultMaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	assert.True(t, transport.ForceAttemptHTTP2)
+	assert.Nil(t, transport.TLSNextProto)
+	assert.NotNil(t, transport.Proxy)
+	assert.NotNil(t, transport.DialContext)
+}
+
+func TestNewClientOptions(t *testing.T) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS13}
+	httpClient, ok := NewClient(
+		WithTimeout(time.Minute),
+		WithTLSHandshakeTimeout(time.Second),
+		WithResponseHeaderTimeout(2*time.Second),
+		WithIdleConnTimeout(3*time.Second),
+		WithMaxIdleConns(5),
+		WithMaxIdleConnsPerHost(2),
+		WithMaxConnsPerHost(4),
+		WithHTTP2(false),
+		WithProxy(nil),
+		WithTLSConfig(tlsConfig),
+	).(*http.Client)
+	require.True(t, ok)
+	transport := httpClient.Transport.(*http.Transport)
+
+	assert.Equal(t, time.Minute, httpClient.Timeout)
+	assert.Equal(t, time.Second, transport.TLSHandshakeTimeout)
+	assert.Equal(t, 2*time.Second, transport.ResponseHeaderTimeout)
+	assert.Equal(t, 3*time.Second, transport.IdleConnTimeout)
+	assert.Equal(t, 5, transport.MaxIdleConns)
+	assert.Equal(t, 2, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 4, transport.MaxConnsPerHost)
+	assert.False(t, transport.ForceAttemptHTTP2)
+	assert.NotNil(t, transport.TLSNextProto)
+	assert.Empty(t, transport.TLSNextProto)
+	assert.Nil(t, transport.Proxy)
+	assert.Same(t, tlsConfig, transport.TLSClientConfig)
+}
+
+func TestNewClient(t *testing.T) {
+	t.Run("http2", func(t *testing.T) {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, r.Proto)
+		}))
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		defer server.Close()
+		tlsConfig := server.Client().Transport.(*http.Transport).TLSClientConfig
+
+		body, err := getBody(NewClient(WithTLSConfig(tlsConfig.Clone())), server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, "HTTP/2.0", body)
+
+		body, err = getBody(NewClient(WithTLSConfig(tlsConfig.Clone()), WithHTTP2(false)), server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, "HTTP/1.1", body)
+	})
+
+	t.Run("response header timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer server.Close()
+		defer close(release)
+
+		_, err := HttpGetWithContext(context.Background(), NewClient(WithResponseHeaderTimeout(50*time.Millisecond)), server.URL, nil)
+		assert.ErrorContains(t, err, "timeout awaiting response headers")
+	})
+
+	t.Run("middlewares", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, r.Header.Get("User-Agent"))
+		}))
+		defer server.Close()
+
+		body, err := getBody(NewClient(WithMiddlewares(UserAgentMiddleware("armo-agent/1.0"))), server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, "armo-agent/1.0", body)
+	})
+}
@@ -0,0 +1,90 @@
+package httputils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Compressor compresses request bodies
+// only gzip is built in, to keep the package free of third-party compression libraries,
+// zstd (e.g. with github.com/klauspost/compress/zstd) or any other encoding is left to callers implementing this interface
+type Compressor interface {
+	// ContentEncoding is the value of the Content-Encoding header of a compressed body, e.g. "gzip"
+	ContentEncoding() string
+	// NewWriter returns a writer compressing to w, the compressed data is complete once it is closed
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+// GzipCompressor is the gzip Compressor, the zero value uses the default compression level
+type GzipCompressor struct {
+	// Level is one of the compress/gzip levels, 0 means gzip.DefaultCompression
+	Level int
+}
+
+var _ Compressor = GzipCompressor{}
+
+func (c GzipCompressor) ContentEncoding() string {
+	return "gzip"
+}
+
+func (c GzipCompressor) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+// Compress returns body compressed with compressor
+func Compress(body []byte, compressor Compressor) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, err := compressor.NewWriter(buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// HttpPostCompressedWithPolicy compresses the body once, sets the Content-Encoding header and posts it like HttpPostWithPolicy
+// a nil compressor sends the body uncompressed
+func HttpPostCompressedWithPolicy(ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string, body []byte, compressor Compressor, policy *RetryPolicy) (*http.Response, error) {
+	if compressor == nil {
+		return HttpPostWithPolicy(ctx, httpClient, fullURL, headers, body, policy)
+	}
+	compressed, err := Compress(body, compressor)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress request body: %w", err)
+	}
+	compressedHeaders := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		// canonical keys let the compressor's Content-Encoding replace the caller's whatever its case
+		compressedHeaders[http.CanonicalHeaderKey(k)] = v
+	}
+	compressedHeaders["Content-Encoding"] = compressor.ContentEncoding()
+	return HttpPostWithPolicy(ctx, httpClient, fullURL, compressedHeaders, compressed, policy)
+}
+
+// EstimateJSONCompressionRatio returns the ratio between the compressed and the uncompressed size of the json encoding of sample
+// use it as ChunkerConfig.CompressionRatio with a sample that is representative of the sliced data
+func EstimateJSONCompressionRatio[T any](sample []T, compressor Compressor) (float64, error) {
+	encoded, err := json.Marshal(sample)
+	if err != nil {
+		return 0, err
+	}
+	compressed, err := Compress(encoded, compressor)
+	if err != nil {
+		return 0, err
+	}
+	return float64(len(compressed)) / float64(len(encoded)), nil
+}
@@ -0,0 +1,107 @@
+package httputils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompress(t *testing.T) {
+	body := []byte(`{"name":"CVE-2016-2781","name":"CVE-2016-2781","name":"CVE-2016-2781"}`)
+	compressed, err := Compress(body, GzipCompressor{Level: gzip.BestCompression})
+	assert.NoError(t, err)
+	assert.Less(t, len(compressed), len(body))
+
+	r, err := gzip.NewReader(bytes.NewReader(compressed))
+	assert.NoError(t, err)
+	decompressed, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, body, decompressed)
+}
+
+func TestHttpPostCompressedWithPolicy(t *testing.T) {
+	body := []byte(`[{"name":"CVE-2016-2781"},{"name":"CVE-2020-16156"}]`)
+	retryCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		retryCount++
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		gz, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		received, err := io.ReadAll(gz)
+		assert.NoError(t, err)
+		assert.Equal(t, body, received)
+		if retryCount == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	resp, err := HttpPostCompressedWithPolicy(context.Background(), server.Client(), server.URL, headers, body, GzipCompressor{}, fastRetryPolicy())
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 2, retryCount)
+	// the caller's headers are not modified
+	assert.Len(t, headers, 1)
+
+	t.Run("lower case header is replaced by the compressor's", func(t *testing.T) {
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, []string{"gzip"}, req.Header.Values("Content-Encoding"))
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			},
+		}
+		headers := map[string]string{"content-encoding": "identity"}
+		// the headers are set in map order, repeat to cover both orders
+		for i := 0; i < 20; i++ {
+			_, err := HttpPostCompressedWithPolicy(context.Background(), httpClient, "http://example.com", headers, body, GzipCompressor{}, fastRetryPolicy())
+			assert.NoError(t, err)
+		}
+	})
+}
+
+func TestChunkerCompressionRatio(t *testing.T) {
+	slice := newChunkerTestSlice(2000)
+	compressor := GzipCompressor{}
+	ratio, err := EstimateJSONCompressionRatio(slice[:200], compressor)
+	assert.NoError(t, err)
+	assert.Greater(t, ratio, 0.0)
+	assert.Less(t, ratio, 1.0)
+
+	maxBytes := 4096
+	uncompressedChunks, err := NewChunker(ChunkerConfig[chunkerTestStruct]{MaxBytes: maxBytes}).Split(slice)
+	assert.NoError(t, err)
+	compressedChunks, err := NewChunker(ChunkerConfig[chunkerTestStruct]{MaxBytes: maxBytes, CompressionRatio: ratio}).Split(slice)
+	assert.NoError(t, err)
+	assert.Less(t, len(compressedChunks), len(uncompressedChunks))
+
+	for _, chunk := range compressedChunks[:len(compressedChunks)-1] {
+		encoded, err := json.Marshal(chunk)
+		assert.NoError(t, err)
+		compressed, err := Compress(encoded, compressor)
+		assert.NoError(t, err)
+		// the ratio is an estimation, the compressed chunks are close to the limit but can exceed it
+		assert.InDelta(t, maxBytes, len(compressed), float64(maxBytes)*0.25)
+	}
+
+	// a safety margin keeps the chunks under a hard limit
+	hardLimit := maxBytes
+	safeChunks, err := NewChunker(ChunkerConfig[chunkerTestStruct]{MaxBytes: hardLimit * 3 / 4, CompressionRatio: ratio}).Split(slice)
+	assert.NoError(t, err)
+	for _, chunk := range safeChunks {
+		encoded, err := json.Marshal(chunk)
+		assert.NoError(t, err)
+		compressed, err := Compress(encoded, compressor)
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, len(compressed), hardLimit)
+	}
+}
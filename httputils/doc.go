@@ -0,0 +1,10 @@
+// Package httputils contains helpers to send HTTP requests with retries, JSON encoding, chunking and streaming of large payloads,
+// and middlewares (authentication, signing, rate limiting, circuit breaking) decorating an IHttpClient
+//
+// Every helper takes an IHttpClient, NewClient returns the recommended one:
+//
+//	httpClient := httputils.NewClient(httputils.WithMiddlewares(httputils.UserAgentMiddleware("my-agent")))
+//	resp, err := httputils.HttpGetWithPolicy(ctx, httpClient, fullURL, nil, httputils.DefaultRetryPolicy())
+//
+// http.DefaultClient has no timeout at all, a server that stops responding blocks the caller forever
+package httputils
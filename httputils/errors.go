@@ -0,0 +1,142 @@
+package httputils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxErrorBodySize is the number of response body bytes kept in an HTTPError
+const maxErrorBodySize = 1024
+
+// redactedValue replaces secrets in URLs, same as url.URL.Redacted does for passwords
+const redactedValue = "xxxxx"
+
+// sensitiveQueryParams - query parameters containing one of these (lowercase) words are redacted
+var sensitiveQueryParams = []string{"token", "secret", "password", "passwd", "key", "signature", "credential", "auth"}
+
+// HTTPError is returned when a server answers with a non 2xx status code
+type HTTPError struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// Status is the HTTP status text of the response, e.g. "404 Not Found"
+	Status string
+	// Method is the method of the request
+	Method string
+	// URL is the URL of the request with the secrets redacted
+	URL string
+	// Body is the beginning of the response body, truncated to 1024 bytes
+	Body string
+	// Header is the headers of the response
+	Header http.Header
+	// Err is the error that occurred while reading the response body, if any
+	Err error
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("http-error: '%s', reason: '%s', read-error: '%s'", e.Status, e.Body, e.Err.Error())
+	}
+	return fmt.Sprintf("http-error: '%s', reason: '%s'", e.Status, e.Body)
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// newHTTPError builds an HTTPError out of a response and the beginning of its body
+// the method and URL are taken from req, or from resp.Request when req is nil
+func newHTTPError(req *http.Request, resp *http.Response, body string) *HTTPError {
+	if len(body) > maxErrorBodySize {
+		body = body[:maxErrorBodySize]
+	}
+	httpErr := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       body,
+		Header:     resp.Header,
+	}
+	if httpErr.Status == "" {
+		httpErr.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	if req == nil {
+		req = resp.Request
+	}
+	if req != nil {
+		httpErr.Method = req.Method
+		httpErr.URL = RedactURL(req.URL)
+	}
+	return httpErr
+}
+
+// httpErrorFromResponse builds an HTTPError out of a non 2xx response, reading the beginning of its body
+// the body is left open, the caller closes it
+func httpErrorFromResponse(req *http.Request, resp *http.Response) *HTTPError {
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	return newHTTPError(req, resp, string(respBody))
+}
+
+// RedactURL returns the URL as a string with its password and sensitive query parameters redacted
+func RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	redacted := *u
+	if redacted.RawQuery != "" {
+		query := redacted.Query()
+		for k := range query {
+			if isSensitiveQueryParam(k) {
+				query.Set(k, redactedValue)
+			}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.Redacted()
+}
+
+func isSensitiveQueryParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range sensitiveQueryParams {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// statusCodeOf returns the status code of an HTTPError wrapped in err
+func statusCodeOf(err error) (int, bool) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode, true
+	}
+	return 0, false
+}
+
+// IsNotFound returns true if err is an HTTPError with a 404 status code
+func IsNotFound(err error) bool {
+	statusCode, ok := statusCodeOf(err)
+	return ok && statusCode == http.StatusNotFound
+}
+
+// IsAuthError returns true if err is an HTTPError with a 401 or 403 status code
+func IsAuthError(err error) bool {
+	statusCode, ok := statusCodeOf(err)
+	return ok && (statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden)
+}
+
+// IsRetryable returns true if err is an HTTPError with a status code indicating a transient failure
+func IsRetryable(err error) bool {
+	statusCode, ok := statusCodeOf(err)
+	if !ok {
+		return false
+	}
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
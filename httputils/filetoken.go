@@ -0,0 +1,155 @@
+package httputils
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultServiceAccountTokenPath is the path of the service account token mounted in Kubernetes pods
+const DefaultServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// DefaultTokenFileTTL is how long a token read from a file is reused by default before the file is read again
+const DefaultTokenFileTTL = time.Minute
+
+// FileTokenSource is a TokenSource reading a bearer token from a file that is rotated on disk,
+// such as a Kubernetes projected service account token
+// the file is read again when its modification time or size change, when the TTL expires or when the token expires
+// the expiry of the token is parsed from its JWT claims, tokens that are not JWTs never expire
+type FileTokenSource struct {
+	path    string
+	ttl     time.Duration
+	mutex   sync.Mutex
+	token   *Token
+	readAt  time.Time
+	modTime time.Time
+	size    int64
+	now     func() time.Time
+}
+
+var _ TokenSource = &FileTokenSource{}
+
+// NewFileTokenSource returns a FileTokenSource for the file at path (DefaultServiceAccountTokenPath if empty),
+// a ttl <= 0 means DefaultTokenFileTTL
+func NewFileTokenSource(path string, ttl time.Duration) *FileTokenSource {
+	if path == "" {
+		path = DefaultServiceAccountTokenPath
+	}
+	if ttl <= 0 {
+		ttl = DefaultTokenFileTTL
+	}
+	return &FileTokenSource{
+		path: path,
+		ttl:  ttl,
+		now:  time.Now,
+	}
+}
+
+// ServiceAccountTokenMiddleware authenticates every request with the token of the file at path (DefaultServiceAccountTokenPath if empty),
+// see FileTokenSource and BearerTokenMiddleware
+func ServiceAccountTokenMiddleware(path string) Middleware {
+	return BearerTokenMiddleware(NewFileTokenSource(path, DefaultTokenFileTTL))
+}
+
+// Token returns the token of the file, reading the file again if it changed or the cached token is stale
+// if the file cannot be read, the cached token is used until it expires
+func (s *FileTokenSource) Token(context.Context) (*Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	info, statErr := os.Stat(s.path)
+	if s.token != nil && statErr == nil && !s.token.expiresWithin(now, 0) && now.Before(s.readAt.Add(s.ttl)) &&
+		info.ModTime().Equal(s.modTime) && info.Size() == s.size {
+		return s.token, nil
+	}
+
+	token, err := s.read()
+	if err == nil {
+		err = statErr
+	}
+	if err != nil {
+		if s.token != nil && !s.token.expiresWithin(now, 0) {
+			return s.token, nil
+		}
+		return nil, err
+	}
+	s.token = token
+	s.readAt = now
+	s.modTime = info.ModTime()
+	s.size = info.Size()
+	return token, nil
+}
+
+// Invalidate drops the cached token if it is still token, so the next call to Token reads the file again
+func (s *FileTokenSource) Invalidate(token *Token) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.token == token {
+		s.token = nil
+	}
+}
+
+// Expiry returns the expiry of the last token read from the file, the zero value if there is none or it never expires
+func (s *FileTokenSource) Expiry() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.token == nil {
+		return time.Time{}
+	}
+	return s.token.Expiry
+}
+
+func (s *FileTokenSource) read() (*Token, error) {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token file: %w", err)
+	}
+	accessToken := string(bytes.TrimSpace(content))
+	if accessToken == "" {
+		return nil, fmt.Errorf("token file '%s' is empty", s.path)
+	}
+	token := &Token{AccessToken: accessToken}
+	if strings.Count(accessToken, ".") == 2 {
+		if token.Expiry, err = ParseJWTExpiry(accessToken); err != nil {
+			return nil, fmt.Errorf("failed to parse token file '%s': %w", s.path, err)
+		}
+	}
+	return token, nil
+}
+
+// ParseJWTExpiry returns the time of the exp claim of a JWT, the zero value if it has none
+// the signature of the token is not verified
+func ParseJWTExpiry(jwt string) (time.Time, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("malformed jwt: expected 3 parts")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed jwt payload: %w", err)
+	}
+	var claims struct {
+		Exp json.Number `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("malformed jwt claims: %w", err)
+	}
+	if claims.Exp == "" {
+		return time.Time{}, nil
+	}
+	exp, err := claims.Exp.Float64()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed jwt exp claim: %w", err)
+	}
+	sec, frac := math.Modf(exp)
+	return time.Unix(int64(sec), int64(frac*1e9)), nil
+}
@@ -0,0 +1,119 @@
+package httputils
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestJWT(subject string, exp time.Time) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"%s","exp":%d}`, subject, exp.Unix())))
+	return header + "." + payload + ".signature"
+}
+
+func writeTokenFile(t *testing.T, path, token string, modTime time.Time) {
+	assert.NoError(t, os.WriteFile(path, []byte(token+"\n"), 0600))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestParseJWTExpiry(t *testing.T) {
+	exp := time.Unix(1700000000, 0)
+	got, err := ParseJWTExpiry(newTestJWT("a", exp))
+	assert.NoError(t, err)
+	assert.True(t, exp.Equal(got))
+
+	got, err = ParseJWTExpiry("e30.e30.sig")
+	assert.NoError(t, err)
+	assert.True(t, got.IsZero())
+
+	_, err = ParseJWTExpiry("not-a-jwt")
+	assert.Error(t, err)
+	_, err = ParseJWTExpiry("e30.!!!.sig")
+	assert.Error(t, err)
+}
+
+func TestFileTokenSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	clock := &fakeClock{now: time.Now()}
+	modTime := clock.now.Add(-time.Hour)
+	exp := clock.now.Add(time.Hour).Truncate(time.Second)
+	writeTokenFile(t, path, newTestJWT("first", exp), modTime)
+
+	source := NewFileTokenSource(path, 10*time.Minute)
+	source.now = clock.Now
+
+	token, err := source.Token(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, newTestJWT("first", exp), token.AccessToken)
+	assert.True(t, exp.Equal(source.Expiry()))
+
+	t.Run("rotation is detected", func(t *testing.T) {
+		exp = exp.Add(time.Hour)
+		modTime = modTime.Add(time.Minute)
+		writeTokenFile(t, path, newTestJWT("second", exp), modTime)
+
+		token, err := source.Token(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, newTestJWT("second", exp), token.AccessToken)
+		assert.True(t, exp.Equal(source.Expiry()))
+	})
+
+	t.Run("file is read again after the ttl", func(t *testing.T) {
+		// same size and modification time, only the ttl reveals the change
+		writeTokenFile(t, path, newTestJWT("third_", exp), modTime)
+		token, _ := source.Token(context.Background())
+		assert.Equal(t, newTestJWT("second", exp), token.AccessToken)
+
+		clock.now = clock.now.Add(11 * time.Minute)
+		token, err := source.Token(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, newTestJWT("third_", exp), token.AccessToken)
+	})
+
+	t.Run("missing file falls back to the unexpired token", func(t *testing.T) {
+		assert.NoError(t, os.Remove(path))
+		clock.now = clock.now.Add(11 * time.Minute)
+		token, err := source.Token(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, newTestJWT("third_", exp), token.AccessToken)
+
+		clock.now = exp
+		_, err = source.Token(context.Background())
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestServiceAccountTokenMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	writeTokenFile(t, path, "opaque-1", time.Now().Add(-time.Hour))
+
+	var received []string
+	httpClient := Chain(&mockHttpClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			received = append(received, req.Header.Get("Authorization"))
+			if req.Header.Get("Authorization") != "Bearer opaque-2" {
+				return &http.Response{StatusCode: http.StatusUnauthorized, Body: http.NoBody}, nil
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		},
+	}, ServiceAccountTokenMiddleware(path))
+
+	resp, err := HttpGet(httpClient, "http://example.com", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// the rotated token is picked up right away
+	writeTokenFile(t, path, "opaque-2", time.Now())
+	resp, err = HttpGet(httpClient, "http://example.com", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"Bearer opaque-1", "Bearer opaque-2"}, received)
+}
@@ -4,16 +4,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
-
-	"github.com/cenkalti/backoff/v4"
 )
 
+// IHttpClient sends HTTP requests, it is implemented by *http.Client, see NewClient for the recommended one
 type IHttpClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
@@ -31,6 +31,10 @@ func HttpDelete(httpClient IHttpClient, fullURL string, headers map[string]strin
 	return HttpDeleteWithContext(context.Background(), httpClient, fullURL, headers)
 }
 
+func HttpDeleteWithRetry(httpClient IHttpClient, fullURL string, headers map[string]string, maxElapsedTime time.Duration) (*http.Response, error) {
+	return HttpDeleteWithContextAndRetry(context.Background(), httpClient, fullURL, headers, maxElapsedTime, defaultShouldRetry)
+}
+
 func HttpDeleteWithContext(ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, "DELETE", fullURL, nil)
 	if err != nil {
@@ -41,10 +45,18 @@ func HttpDeleteWithContext(ctx context.Context, httpClient IHttpClient, fullURL
 	return httpClient.Do(req)
 }
 
+func HttpDeleteWithContextAndRetry(ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string, maxElapsedTime time.Duration, shouldRetry func(resp *http.Response) bool) (*http.Response, error) {
+	return httpDoWithRetry(ctx, httpClient, "DELETE", fullURL, headers, nil, legacyRetryPolicy(maxElapsedTime, shouldRetry))
+}
+
 func HttpHead(httpClient IHttpClient, fullURL string, headers map[string]string) (*http.Response, error) {
 	return HttpHeadWithContext(context.Background(), httpClient, fullURL, headers)
 }
 
+func HttpHeadWithRetry(httpClient IHttpClient, fullURL string, headers map[string]string, maxElapsedTime time.Duration) (*http.Response, error) {
+	return HttpHeadWithContextAndRetry(context.Background(), httpClient, fullURL, headers, maxElapsedTime, defaultShouldRetry)
+}
+
 func HttpHeadWithContext(ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, "HEAD", fullURL, nil)
 	if err != nil {
@@ -55,10 +67,18 @@ func HttpHeadWithContext(ctx context.Context, httpClient IHttpClient, fullURL st
 	return httpClient.Do(req)
 }
 
+func HttpHeadWithContextAndRetry(ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string, maxElapsedTime time.Duration, shouldRetry func(resp *http.Response) bool) (*http.Response, error) {
+	return httpDoWithRetry(ctx, httpClient, "HEAD", fullURL, headers, nil, legacyRetryPolicy(maxElapsedTime, shouldRetry))
+}
+
 func HttpGet(httpClient IHttpClient, fullURL string, headers map[string]string) (*http.Response, error) {
 	return HttpGetWithContext(context.Background(), httpClient, fullURL, headers)
 }
 
+func HttpGetWithRetry(httpClient IHttpClient, fullURL string, headers map[string]string, maxElapsedTime time.Duration) (*http.Response, error) {
+	return HttpGetWithContextAndRetry(context.Background(), httpClient, fullURL, headers, maxElapsedTime, defaultShouldRetry)
+}
+
 func HttpGetWithContext(ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", fullURL, nil)
 	if err != nil {
@@ -69,6 +89,10 @@ func HttpGetWithContext(ctx context.Context, httpClient IHttpClient, fullURL str
 	return httpClient.Do(req)
 }
 
+func HttpGetWithContextAndRetry(ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string, maxElapsedTime time.Duration, shouldRetry func(resp *http.Response) bool) (*http.Response, error) {
+	return httpDoWithRetry(ctx, httpClient, "GET", fullURL, headers, nil, legacyRetryPolicy(maxElapsedTime, shouldRetry))
+}
+
 func HttpPost(httpClient IHttpClient, fullURL string, headers map[string]string, body []byte) (*http.Response, error) {
 	return HttpPostWithContext(context.Background(), httpClient, fullURL, headers, body, -1, func(resp *http.Response) bool {
 		return true
@@ -80,44 +104,7 @@ func HttpPostWithRetry(httpClient IHttpClient, fullURL string, headers map[strin
 }
 
 func HttpPostWithContext(ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string, body []byte, maxElapsedTime time.Duration, shouldRetry func(resp *http.Response) bool) (*http.Response, error) {
-	var resp *http.Response
-	var err error
-
-	operation := func() error {
-		req, err := http.NewRequestWithContext(ctx, "POST", fullURL, bytes.NewReader(body))
-		if err != nil {
-			return backoff.Permanent(err)
-		}
-		setHeaders(req, headers)
-
-		resp, err = httpClient.Do(req)
-		if err != nil {
-			return err
-		}
-
-		// If the status code is not 200, we will retry
-		if resp.StatusCode != http.StatusOK {
-			if shouldRetry(resp) {
-				// only close the body if we are going to retry
-				_ = resp.Body.Close()
-				return fmt.Errorf("received status code: %d", resp.StatusCode)
-			}
-			return backoff.Permanent(err)
-		}
-
-		return nil
-	}
-
-	// Create a new exponential backoff policy
-	expBackOff := backoff.NewExponentialBackOff()
-	expBackOff.MaxElapsedTime = maxElapsedTime // Set the maximum elapsed time
-
-	// Run the operation with the exponential backoff policy
-	if err = backoff.Retry(operation, expBackOff); err != nil {
-		return resp, err
-	}
-
-	return resp, nil
+	return httpDoWithRetry(ctx, httpClient, "POST", fullURL, headers, bytesBody(body), legacyRetryPolicy(maxElapsedTime, shouldRetry))
 }
 
 func defaultShouldRetry(resp *http.Response) bool {
@@ -136,37 +123,99 @@ func setHeaders(req *http.Request, headers map[string]string) {
 	}
 }
 
+// maxBodyPreallocSize caps the buffer pre-allocated from the server-controlled Content-Length
+const maxBodyPreallocSize = 1 << 20
+
+// ErrBodyTooLarge is returned (wrapped in an *HTTPError) when a response body exceeds the read limit
+var ErrBodyTooLarge = errors.New("response body too large")
+
 // HttpRespToString parses the body as string and checks the HTTP status code, it closes the body reader at the end
 func HttpRespToString(resp *http.Response) (string, error) {
+	return HttpRespToStringWithLimit(resp, 0)
+}
+
+// HttpRespToStringWithLimit - same as HttpRespToString, but fails with ErrBodyTooLarge if the body is bigger than limit bytes
+// a limit <= 0 means unlimited
+func HttpRespToStringWithLimit(resp *http.Response, limit int64) (string, error) {
 	if resp == nil || resp.Body == nil {
 		return "", nil
 	}
 	strBuilder := strings.Builder{}
+	err := readRespBody(resp, &strBuilder, limit)
+	respStr := strBuilder.String()
+	if err != nil {
+		httpErr := newHTTPError(nil, resp, respStr)
+		httpErr.Err = err
+		return "", httpErr
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err = newHTTPError(nil, resp, respStr)
+	}
+
+	return respStr, err
+}
+
+// HttpRespToBytes reads the body and checks the HTTP status code, it closes the body reader at the end
+func HttpRespToBytes(resp *http.Response) ([]byte, error) {
+	return HttpRespToBytesWithLimit(resp, 0)
+}
+
+// HttpRespToBytesWithLimit - same as HttpRespToBytes, but fails with ErrBodyTooLarge if the body is bigger than limit bytes
+// a limit <= 0 means unlimited
+func HttpRespToBytesWithLimit(resp *http.Response, limit int64) ([]byte, error) {
+	if resp == nil || resp.Body == nil {
+		return nil, nil
+	}
+	buf := bytes.Buffer{}
+	err := readRespBody(resp, &buf, limit)
+	respBytes := buf.Bytes()
+	if err != nil {
+		httpErr := newHTTPError(nil, resp, truncatedBody(respBytes))
+		httpErr.Err = err
+		return nil, httpErr
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		err = newHTTPError(nil, resp, truncatedBody(respBytes))
+	}
+
+	return respBytes, err
+}
+
+// readRespBody copies at most limit bytes (unless limit <= 0) of the response body to w and closes the body
+func readRespBody(resp *http.Response, w interface {
+	io.Writer
+	Grow(n int)
+}, limit int64) error {
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
 	}(resp.Body)
+	if limit > 0 && resp.ContentLength > limit {
+		return fmt.Errorf("%w: content length %d exceeds the limit of %d bytes", ErrBodyTooLarge, resp.ContentLength, limit)
+	}
 	if resp.ContentLength > 0 {
-		strBuilder.Grow(int(resp.ContentLength))
+		w.Grow(int(min(resp.ContentLength, maxBodyPreallocSize)))
 	}
-	_, err := io.Copy(&strBuilder, resp.Body)
-	respStr := strBuilder.String()
+	if limit <= 0 {
+		_, err := io.Copy(w, resp.Body)
+		return err
+	}
+	// read one extra byte to detect bodies bigger than the limit
+	n, err := io.Copy(w, io.LimitReader(resp.Body, limit+1))
 	if err != nil {
-		respStrNewLen := len(respStr)
-		if respStrNewLen > 1024 {
-			respStrNewLen = 1024
-		}
-		return "", fmt.Errorf("http-error: '%s', reason: '%s'", resp.Status, respStr[:respStrNewLen])
-		// return "", fmt.Errorf("HTTP request failed. URL: '%s', Read-ERROR: '%s', HTTP-CODE: '%s', BODY(top): '%s', HTTP-HEADERS: %v, HTTP-BODY-BUFFER-LENGTH: %v", resp.Request.URL.RequestURI(), err, resp.Status, respStr[:respStrNewLen], resp.Header, bytesNum)
+		return err
 	}
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		respStrNewLen := len(respStr)
-		if respStrNewLen > 1024 {
-			respStrNewLen = 1024
-		}
-		err = fmt.Errorf("http-error: '%s', reason: '%s'", resp.Status, respStr[:respStrNewLen])
+	if n > limit {
+		return fmt.Errorf("%w: exceeds the limit of %d bytes", ErrBodyTooLarge, limit)
 	}
+	return nil
+}
 
-	return respStr, err
+// truncatedBody returns the beginning of the body kept in an HTTPError
+func truncatedBody(body []byte) string {
+	if len(body) > maxErrorBodySize {
+		body = body[:maxErrorBodySize]
+	}
+	return string(body)
 }
 
 func Split2Chunks[T any](maxNumOfChunks int, slice []T) [][]T {
@@ -199,7 +248,7 @@ func SplitSlice2Chunks[T any](slice []T, maxSize int, channelBuffer int) (chunks
 	if sliceSize > 0 {
 		go func(chunksChannel chan<- []T) {
 			splitWg := &sync.WaitGroup{}
-			splitSlice2Chunks(slice, maxSize, chunksChannel, splitWg)
+			splitSlice2Chunks(context.Background(), slice, maxSize, chunksChannel, splitWg, lenientJSONSize, nil)
 			splitWg.Wait()
 			close(chunksChannel)
 		}(channel)
@@ -210,50 +259,180 @@ func SplitSlice2Chunks[T any](slice []T, maxSize int, channelBuffer int) (chunks
 	return chunksChannel, sliceSize
 }
 
-func splitSlice2Chunks[T any](slice []T, maxSize int, chunks chan<- []T, wg *sync.WaitGroup) {
+// SplitSlice2ChunksWithContext - same as SplitSlice2Chunks, but stops splitting as soon as ctx is done
+// or an element cannot be encoded to json, in which case the chunks channel is closed without waiting for a consumer
+// Returns an errors channel receiving at most one error (the encoding error or the context error),
+// it is closed after the chunks channel is closed
+func SplitSlice2ChunksWithContext[T any](ctx context.Context, slice []T, maxSize int, channelBuffer int) (chunksChannel <-chan []T, sliceSize int, errChannel <-chan error) {
+	channel := make(chan []T, channelBuffer)
+	errs := make(chan error, 1)
+	sliceSize = len(slice)
+	go func(chunksChannel chan<- []T) {
+		defer close(errs)
+		if sliceSize == 1 {
+			// a single element is never measured by the splitter, make sure it can be encoded
+			if _, err := JSONSizeWithError(slice); err != nil {
+				close(chunksChannel)
+				errs <- err
+				return
+			}
+		}
+		splitCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		var splitErr error
+		errOnce := sync.Once{}
+		onError := func(err error) {
+			errOnce.Do(func() {
+				splitErr = err
+				cancel()
+			})
+		}
+		if sliceSize > 0 {
+			splitWg := &sync.WaitGroup{}
+			splitSlice2Chunks(splitCtx, slice, maxSize, chunksChannel, splitWg, JSONSizeWithError, onError)
+			splitWg.Wait()
+		}
+		close(chunksChannel)
+		if splitErr == nil {
+			splitErr = ctx.Err()
+		}
+		if splitErr != nil {
+			errs <- splitErr
+		}
+	}(channel)
+	return channel, sliceSize, errs
+}
+
+// Chunk is a chunk of a slice tagged with its position in the original slice
+type Chunk[T any] struct {
+	// Index is the position of the chunk in the sequence of chunks
+	Index int
+	// Start is the offset of the first element of the chunk in the original slice
+	Start int
+	// End is the offset after the last element of the chunk in the original slice, Items is slice[Start:End]
+	End int
+	// Items are the elements of the chunk
+	Items []T
+}
+
+// SplitSlice2OrderedChunks - splits a slice to the same chunks as SplitSlice2ChunksBySize, with the context handling of SplitSlice2ChunksWithContext
+// the chunks are sent in the original slice order and tagged with their index and offsets
+// Chunks might be bigger than max size if the slice contains element(s) that are bigger than the max size
+// Returns an errors channel receiving at most one error (the encoding error or the context error),
+// it is closed after the chunks channel is closed
+func SplitSlice2OrderedChunks[T any](ctx context.Context, slice []T, maxSize int, channelBuffer int) (chunksChannel <-chan Chunk[T], sliceSize int, errChannel <-chan error) {
+	channel := make(chan Chunk[T], channelBuffer)
+	errs := make(chan error, 1)
+	sliceSize = len(slice)
+	go func(chunksChannel chan<- Chunk[T]) {
+		defer close(errs)
+		err := splitSlice2OrderedChunks(ctx, slice, maxSize, chunksChannel)
+		close(chunksChannel)
+		if err != nil {
+			errs <- err
+		}
+	}(channel)
+	return channel, sliceSize, errs
+}
+
+func splitSlice2OrderedChunks[T any](ctx context.Context, slice []T, maxSize int, chunks chan<- Chunk[T]) error {
+	index := 0
+	err := jsonChunkPacker[T](maxSize).pack(slice, func(start, end int) error {
+		chunk := Chunk[T]{Index: index, Start: start, End: end, Items: slice[start:end]}
+		select {
+		case chunks <- chunk:
+			index++
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func splitSlice2Chunks[T any](ctx context.Context, slice []T, maxSize int, chunks chan<- []T, wg *sync.WaitGroup, sizeOf func(i interface{}) (int, error), onError func(err error)) {
 	wg.Add(1)
 	go func(slice []T, maxSize int, chunks chan<- []T, wg *sync.WaitGroup) {
 		defer wg.Done()
+		if ctx.Err() != nil {
+			return
+		}
 		if len(slice) < 2 {
 			//cannot split if the slice is empty or has one element
-			chunks <- slice
+			sendChunk(ctx, chunks, slice)
 			return
 		}
 		//check slice size
-		jsonSize := JSONSize(slice)
+		jsonSize, err := sizeOf(slice)
+		if err != nil {
+			onError(err)
+			return
+		}
 		if jsonSize <= maxSize {
 			//slice size is smaller than max size no splitting needed
-			chunks <- slice
+			sendChunk(ctx, chunks, slice)
 			return
 		}
 		//slice is bigger than max size
 		//split the slice to slices smaller than max size
 		index := 0
 		for i := range slice {
-			jsonSize = JSONSize(slice[index : i+1])
+			if ctx.Err() != nil {
+				return
+			}
+			jsonSize, err = sizeOf(slice[index : i+1])
+			if err != nil {
+				onError(err)
+				return
+			}
 			if jsonSize > maxSize {
 				//send the part of the slice that is smaller than max size
-				splitSlice2Chunks[T](slice[index:i], maxSize, chunks, wg)
+				splitSlice2Chunks[T](ctx, slice[index:i], maxSize, chunks, wg, sizeOf, onError)
 				index = i
 			}
 		}
 		//send the last part of the slice
-		splitSlice2Chunks[T](slice[index:], maxSize, chunks, wg)
+		splitSlice2Chunks[T](ctx, slice[index:], maxSize, chunks, wg, sizeOf, onError)
 	}(slice, maxSize, chunks, wg)
 }
 
+// sendChunk sends the chunk unless ctx is done first
+func sendChunk[T any](ctx context.Context, chunks chan<- []T, chunk []T) {
+	select {
+	case chunks <- chunk:
+	case <-ctx.Done():
+	}
+}
+
 // JSONSize returns the size in bytes of the json encoding of i
 func JSONSize(i interface{}) int {
+	size, _ := lenientJSONSize(i)
+	return size
+}
+
+// lenientJSONSize - JSONSize with an error signature, encoding errors result in a zero size
+func lenientJSONSize(i interface{}) (int, error) {
+	size, err := JSONSizeWithError(i)
+	if err != nil {
+		return 0, nil
+	}
+	return size, nil
+}
+
+// JSONSizeWithError returns the size in bytes of the json encoding of i, or the encoding error
+func JSONSizeWithError(i interface{}) (int, error) {
 	if i == nil {
-		return 0
+		return 0, nil
 	}
 	counter := bytesCounter{}
 	enc := json.NewEncoder(&counter)
-	err := enc.Encode(i)
-	if err != nil {
-		return 0
+	if err := enc.Encode(i); err != nil {
+		return 0, err
 	}
-	return counter.count
+	return counter.count, nil
 }
 
 // bytesCounter - dummy io writer that just counts bytes without writing
@@ -2,9 +2,15 @@ package httputils
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -253,6 +259,121 @@ func TestSplitSlice2Chunks(t *testing.T) {
 	}
 }
 
+func TestSplitSlice2ChunksWithContext(t *testing.T) {
+	type testStruct struct {
+		Name  string  `json:"name"`
+		Score float64 `json:"score"`
+	}
+	var slice []testStruct
+	for i := 0; i < 50; i++ {
+		slice = append(slice, testStruct{Name: fmt.Sprintf("CVE-2022-%04d", i)})
+	}
+
+	t.Run("all chunks are sent", func(t *testing.T) {
+		chunksChan, sliceSize, errChan := SplitSlice2ChunksWithContext(context.Background(), slice, 100, 10)
+		totalReceived := 0
+		for v := range chunksChan {
+			assert.LessOrEqual(t, JSONSize(v), 100)
+			totalReceived += len(v)
+		}
+		assert.Equal(t, sliceSize, totalReceived)
+		assert.NoError(t, <-errChan)
+	})
+
+	t.Run("empty slice", func(t *testing.T) {
+		chunksChan, sliceSize, errChan := SplitSlice2ChunksWithContext(context.Background(), []testStruct{}, 100, 10)
+		_, ok := <-chunksChan
+		assert.False(t, ok)
+		assert.Equal(t, 0, sliceSize)
+		assert.NoError(t, <-errChan)
+	})
+
+	t.Run("encoding error is reported", func(t *testing.T) {
+		invalid := append([]testStruct{}, slice...)
+		invalid[30].Score = math.Inf(1)
+		chunksChan, _, errChan := SplitSlice2ChunksWithContext(context.Background(), invalid, 100, 10)
+		for range chunksChan {
+		}
+		var unsupportedValueErr *json.UnsupportedValueError
+		assert.ErrorAs(t, <-errChan, &unsupportedValueErr)
+
+		_, _, errChan = SplitSlice2ChunksWithContext(context.Background(), invalid[30:31], 100, 10)
+		assert.ErrorAs(t, <-errChan, &unsupportedValueErr)
+	})
+
+	t.Run("cancellation closes the channel without a consumer", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		chunksChan, _, errChan := SplitSlice2ChunksWithContext(ctx, slice, 100, 0)
+		<-chunksChan
+		cancel()
+		select {
+		case err := <-errChan:
+			assert.ErrorIs(t, err, context.Canceled)
+		case <-time.After(5 * time.Second):
+			t.Fatal("splitting did not stop after the context was cancelled")
+		}
+		for range chunksChan {
+		}
+	})
+}
+
+func TestSplitSlice2OrderedChunks(t *testing.T) {
+	type testStruct struct {
+		Name string `json:"name"`
+	}
+	var slice []testStruct
+	for i := 0; i < 60; i++ {
+		slice = append(slice, testStruct{Name: fmt.Sprintf("CVE-2022-%0*d", 1+i%7, i)})
+	}
+	slice[20].Name = "This is a very long CVE name to test sizes and make sure we don't exceed max size, even more"
+
+	maxSize := 100
+	chunksChan, sliceSize, errChan := SplitSlice2OrderedChunks(context.Background(), slice, maxSize, 0)
+	var ordered [][]testStruct
+	expectedStart := 0
+	for chunk := range chunksChan {
+		assert.Equal(t, len(ordered), chunk.Index)
+		assert.Equal(t, expectedStart, chunk.Start)
+		assert.Equal(t, slice[chunk.Start:chunk.End], chunk.Items)
+		if len(chunk.Items) > 1 {
+			assert.LessOrEqual(t, JSONSize(chunk.Items), maxSize)
+		}
+		expectedStart = chunk.End
+		ordered = append(ordered, chunk.Items)
+	}
+	assert.NoError(t, <-errChan)
+	assert.Equal(t, sliceSize, expectedStart)
+
+	// the ordered mode produces the same chunks as the concurrent one
+	var unordered [][]testStruct
+	concurrentChan, _ := SplitSlice2Chunks(slice, maxSize, 0)
+	for chunk := range concurrentChan {
+		unordered = append(unordered, chunk)
+	}
+	assert.ElementsMatch(t, ordered, unordered)
+
+	t.Run("cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		chunksChan, _, errChan := SplitSlice2OrderedChunks(ctx, slice, maxSize, 0)
+		first := <-chunksChan
+		assert.Equal(t, 0, first.Index)
+		cancel()
+		assert.ErrorIs(t, <-errChan, context.Canceled)
+	})
+}
+
+func TestJSONSizeWithError(t *testing.T) {
+	size, err := JSONSizeWithError([]string{"a", "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, 10, size)
+	assert.Equal(t, size, JSONSize([]string{"a", "b"}))
+
+	size, err = JSONSizeWithError(math.NaN())
+	assert.Error(t, err)
+	assert.Equal(t, 0, size)
+	assert.Equal(t, 0, JSONSize(math.NaN()))
+}
+
 func TestSplit2Chunks(t *testing.T) {
 	type args struct {
 		maxNumOfChunks int
@@ -391,7 +512,6 @@ func TestHttpPostWithContext(t *testing.T) {
 			StatusCode: http.StatusBadGateway,
 			Body:       http.NoBody,
 		}
-		expectedError := fmt.Errorf("received status code: %d", expectedResponse.StatusCode)
 
 		httpClient := &mockHttpClient{
 			doFunc: func(req *http.Request) (*http.Response, error) {
@@ -401,7 +521,11 @@ func TestHttpPostWithContext(t *testing.T) {
 
 		resp, err := HttpPostWithRetry(httpClient, expectedURL, expectedHeaders, expectedBody, defaultMaxTime)
 
-		assert.Equal(t, expectedError, err)
+		var httpErr *HTTPError
+		assert.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, expectedResponse.StatusCode, httpErr.StatusCode)
+		assert.Equal(t, "POST", httpErr.Method)
+		assert.Equal(t, expectedURL, httpErr.URL)
 		assert.Equal(t, expectedResponse.StatusCode, resp.StatusCode)
 	})
 
@@ -434,6 +558,99 @@ func TestHttpPostWithContext(t *testing.T) {
 		assert.Equal(t, expectedResponse.StatusCode, resp.StatusCode)
 		assert.Equal(t, 2, retryCount)
 	})
+
+	t.Run("2xx other than 200 is not retried", func(t *testing.T) {
+		for _, statusCode := range []int{http.StatusCreated, http.StatusAccepted, http.StatusNoContent} {
+			requestCount := 0
+			httpClient := &mockHttpClient{
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					requestCount++
+					return &http.Response{StatusCode: statusCode, Body: http.NoBody}, nil
+				},
+			}
+
+			resp, err := HttpPostWithRetry(httpClient, "http://example.com", nil, []byte("test body"), defaultMaxTime)
+			assert.NoError(t, err)
+			assert.Equal(t, statusCode, resp.StatusCode)
+
+			resp, err = HttpPostWithContext(context.Background(), httpClient, "http://example.com", nil, []byte("test body"), defaultMaxTime, func(*http.Response) bool {
+				return true
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, statusCode, resp.StatusCode)
+			assert.Equal(t, 2, requestCount, statusCode)
+		}
+	})
+}
+
+func TestHttpDoWithRetry(t *testing.T) {
+	defaultMaxTime := 5 * time.Second
+
+	tests := []struct {
+		name   string
+		method string
+		do     func(httpClient IHttpClient, fullURL string) (*http.Response, error)
+	}{
+		{
+			name:   "GET",
+			method: "GET",
+			do: func(httpClient IHttpClient, fullURL string) (*http.Response, error) {
+				return HttpGetWithRetry(httpClient, fullURL, nil, defaultMaxTime)
+			},
+		},
+		{
+			name:   "HEAD",
+			method: "HEAD",
+			do: func(httpClient IHttpClient, fullURL string) (*http.Response, error) {
+				return HttpHeadWithRetry(httpClient, fullURL, nil, defaultMaxTime)
+			},
+		},
+		{
+			name:   "DELETE",
+			method: "DELETE",
+			do: func(httpClient IHttpClient, fullURL string) (*http.Response, error) {
+				return HttpDeleteWithRetry(httpClient, fullURL, nil, defaultMaxTime)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+" retryable error with successful retry", func(t *testing.T) {
+			retryCount := 0
+			httpClient := &mockHttpClient{
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					assert.Equal(t, tt.method, req.Method)
+					retryCount++
+					if retryCount == 1 {
+						return &http.Response{StatusCode: http.StatusBadGateway, Body: http.NoBody}, nil
+					}
+					return &http.Response{StatusCode: http.StatusNoContent, Body: http.NoBody}, nil
+				},
+			}
+
+			resp, err := tt.do(httpClient, "http://example.com")
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+			assert.Equal(t, 2, retryCount)
+		})
+
+		t.Run(tt.name+" non-retryable error", func(t *testing.T) {
+			retryCount := 0
+			httpClient := &mockHttpClient{
+				doFunc: func(req *http.Request) (*http.Response, error) {
+					retryCount++
+					return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody}, nil
+				},
+			}
+
+			resp, err := tt.do(httpClient, "http://example.com")
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+			assert.Equal(t, 1, retryCount)
+		})
+	}
 }
 
 func readRequestBody(req *http.Request) []byte {
@@ -491,3 +708,92 @@ func TestDefaultShouldRetry(t *testing.T) {
 		})
 	}
 }
+
+func TestHttpRespToBytesWithLimit(t *testing.T) {
+	newResp := func(statusCode int, body string, contentLength int64) *http.Response {
+		return &http.Response{
+			StatusCode:    statusCode,
+			Status:        http.StatusText(statusCode),
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: contentLength,
+		}
+	}
+	tests := []struct {
+		name         string
+		resp         *http.Response
+		limit        int64
+		want         string
+		wantErr      bool
+		wantTooLarge bool
+	}{
+		{
+			name:  "unlimited",
+			resp:  newResp(http.StatusOK, "hello world", -1),
+			limit: 0,
+			want:  "hello world",
+		},
+		{
+			name:  "body at the limit",
+			resp:  newResp(http.StatusOK, "hello", 5),
+			limit: 5,
+			want:  "hello",
+		},
+		{
+			name:         "body over the limit",
+			resp:         newResp(http.StatusOK, "hello world", -1),
+			limit:        5,
+			wantErr:      true,
+			wantTooLarge: true,
+		},
+		{
+			name:         "content length over the limit",
+			resp:         newResp(http.StatusOK, "hello world", 11),
+			limit:        5,
+			wantErr:      true,
+			wantTooLarge: true,
+		},
+		{
+			name:  "lying content length is not trusted",
+			resp:  newResp(http.StatusOK, "hi", math.MaxInt32),
+			limit: 0,
+			want:  "hi",
+		},
+		{
+			name:    "non 2xx status",
+			resp:    newResp(http.StatusInternalServerError, "oops", -1),
+			limit:   10,
+			want:    "oops",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HttpRespToBytesWithLimit(tt.resp, tt.limit)
+			if !tt.wantErr {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, string(got))
+				return
+			}
+			assert.Error(t, err)
+			var httpErr *HTTPError
+			assert.True(t, errors.As(err, &httpErr))
+			assert.Equal(t, tt.wantTooLarge, errors.Is(err, ErrBodyTooLarge))
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestHttpRespToStringWithLimit(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("hello world")), ContentLength: -1}
+	_, err := HttpRespToStringWithLimit(resp, 5)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	resp = &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("hello world")), ContentLength: -1}
+	got, err := HttpRespToStringWithLimit(resp, 11)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", got)
+
+	got, err = HttpRespToStringWithLimit(nil, 5)
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+}
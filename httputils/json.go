@@ -0,0 +1,72 @@
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const jsonContentType = "application/json"
+
+// GetJSON sends a GET request and decodes the JSON response into T
+func GetJSON[T any](ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string, policy *RetryPolicy) (T, error) {
+	return DoJSON[any, T](ctx, httpClient, "GET", fullURL, headers, nil, policy)
+}
+
+// PostJSON encodes body as JSON, sends it in a POST request and decodes the JSON response into Resp
+func PostJSON[Req, Resp any](ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string, body Req, policy *RetryPolicy) (Resp, error) {
+	return DoJSON[Req, Resp](ctx, httpClient, "POST", fullURL, headers, &body, policy)
+}
+
+// PutJSON encodes body as JSON, sends it in a PUT request and decodes the JSON response into Resp
+func PutJSON[Req, Resp any](ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string, body Req, policy *RetryPolicy) (Resp, error) {
+	return DoJSON[Req, Resp](ctx, httpClient, "PUT", fullURL, headers, &body, policy)
+}
+
+// DoJSON sends a request with the given method and decodes the JSON response into Resp
+// the body is encoded as JSON unless it is nil, Content-Type and Accept default to application/json
+// the request is retried according to the policy (nil means DefaultRetryPolicy)
+// a non 2xx response is returned as an *HTTPError, an empty response body leaves Resp with its zero value
+func DoJSON[Req, Resp any](ctx context.Context, httpClient IHttpClient, method, fullURL string, headers map[string]string, body *Req, policy *RetryPolicy) (Resp, error) {
+	var result Resp
+
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		bodyBytes, err = json.Marshal(body)
+		if err != nil {
+			return result, fmt.Errorf("failed to encode request body: %w", err)
+		}
+	}
+
+	jsonHeaders := map[string]string{"Accept": jsonContentType}
+	if bodyBytes != nil {
+		jsonHeaders["Content-Type"] = jsonContentType
+	}
+	for k, v := range headers {
+		// canonical keys let the caller's headers replace the defaults whatever their case
+		jsonHeaders[http.CanonicalHeaderKey(k)] = v
+	}
+
+	resp, err := httpDoWithRetry(ctx, httpClient, method, fullURL, jsonHeaders, bytesBody(bodyBytes), policy)
+	if err != nil {
+		return result, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return result, httpErrorFromResponse(nil, resp)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&result); err != nil && !errors.Is(err, io.EOF) {
+		return result, fmt.Errorf("failed to decode response body: %w", err)
+	}
+	return result, nil
+}
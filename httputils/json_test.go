@@ -0,0 +1,134 @@
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetJSON(t *testing.T) {
+	type testStruct struct {
+		Name  string      `json:"name"`
+		Count interface{} `json:"count"`
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+		assert.Equal(t, "", r.Header.Get("Content-Type"))
+		assert.Equal(t, "bar", r.Header.Get("X-Foo"))
+		_, _ = w.Write([]byte(`{"name":"CVE-2016-2781","count":12345678901234567890}`))
+	}))
+	defer server.Close()
+
+	got, err := GetJSON[testStruct](context.Background(), server.Client(), server.URL, map[string]string{"X-Foo": "bar"}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "CVE-2016-2781", got.Name)
+	assert.Equal(t, json.Number("12345678901234567890"), got.Count)
+}
+
+func TestPostJSON(t *testing.T) {
+	type request struct {
+		Names []string `json:"names"`
+	}
+	type response struct {
+		Received int `json:"received"`
+	}
+
+	t.Run("Successful request", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "POST", r.Method)
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			var req request
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			_ = json.NewEncoder(w).Encode(response{Received: len(req.Names)})
+		}))
+		defer server.Close()
+
+		got, err := PostJSON[request, response](context.Background(), server.Client(), server.URL, nil, request{Names: []string{"a", "b"}}, nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, got.Received)
+	})
+
+	t.Run("Lower case header overrides the default", func(t *testing.T) {
+		var contentTypes []string
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				contentTypes = append(contentTypes, req.Header.Get("Content-Type"))
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			},
+		}
+
+		// the map iteration order is random, a few requests make a wrong merge visible
+		for i := 0; i < 20; i++ {
+			_, err := PostJSON[request, response](context.Background(), httpClient, "http://example.com",
+				map[string]string{"content-type": "application/vnd.armo+json"}, request{}, nil)
+			assert.NoError(t, err)
+		}
+		for _, contentType := range contentTypes {
+			assert.Equal(t, "application/vnd.armo+json", contentType)
+		}
+	})
+
+	t.Run("Empty response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		got, err := PostJSON[request, *response](context.Background(), server.Client(), server.URL, nil, request{}, nil)
+
+		assert.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("Non 2xx response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("no such resource"))
+		}))
+		defer server.Close()
+
+		_, err := PostJSON[request, response](context.Background(), server.Client(), server.URL, nil, request{}, nil)
+
+		assert.True(t, IsNotFound(err))
+		httpErr := err.(*HTTPError)
+		assert.Equal(t, "no such resource", httpErr.Body)
+	})
+
+	t.Run("Retried request", func(t *testing.T) {
+		retryCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			retryCount++
+			if retryCount == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(response{Received: 1})
+		}))
+		defer server.Close()
+
+		got, err := PostJSON[request, response](context.Background(), server.Client(), server.URL, nil, request{}, fastRetryPolicy())
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, got.Received)
+		assert.Equal(t, 2, retryCount)
+	})
+
+	t.Run("Invalid response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("not json"))
+		}))
+		defer server.Close()
+
+		_, err := PostJSON[request, response](context.Background(), server.Client(), server.URL, nil, request{}, nil)
+
+		assert.ErrorContains(t, err, "failed to decode response body")
+	})
+}
@@ -0,0 +1,123 @@
+package httputils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// DefaultRequestIDHeader is the header set by RequestIDMiddleware when no header is given
+const DefaultRequestIDHeader = "X-Request-ID"
+
+// HttpClientFunc is an adapter to allow the use of ordinary functions as an IHttpClient
+type HttpClientFunc func(req *http.Request) (*http.Response, error)
+
+func (f HttpClientFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware decorates an IHttpClient
+type Middleware func(httpClient IHttpClient) IHttpClient
+
+// Chain wraps httpClient with the middlewares, the first middleware is the outermost one,
+// i.e. it sees the request first and the response last
+func Chain(httpClient IHttpClient, middlewares ...Middleware) IHttpClient {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		httpClient = middlewares[i](httpClient)
+	}
+	return httpClient
+}
+
+// DefaultHeadersMiddleware sets the headers that are not already set on the request
+func DefaultHeadersMiddleware(headers map[string]string) Middleware {
+	return func(next IHttpClient) IHttpClient {
+		return HttpClientFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			for k, v := range headers {
+				if req.Header.Get(k) == "" {
+					req.Header.Set(k, v)
+				}
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+// UserAgentMiddleware sets the User-Agent header of every request
+func UserAgentMiddleware(userAgent string) Middleware {
+	return func(next IHttpClient) IHttpClient {
+		return HttpClientFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header.Set("User-Agent", userAgent)
+			return next.Do(req)
+		})
+	}
+}
+
+// RequestIDMiddleware sets a random request ID in the given header (DefaultRequestIDHeader if empty)
+// requests that already carry a request ID are left untouched
+func RequestIDMiddleware(header string) Middleware {
+	if header == "" {
+		header = DefaultRequestIDHeader
+	}
+	return func(next IHttpClient) IHttpClient {
+		return HttpClientFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(header) == "" {
+				req = req.Clone(req.Context())
+				req.Header.Set(header, newRequestID())
+			}
+			return next.Do(req)
+		})
+	}
+}
+
+// closeRequestBody closes the body of a request that is not sent,
+// like http.Client.Do a middleware must close the request body even on errors
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// TimingMiddleware calls observe with the duration of every request once the response headers are received
+func TimingMiddleware(observe func(req *http.Request, resp *http.Response, err error, duration time.Duration)) Middleware {
+	return func(next IHttpClient) IHttpClient {
+		return HttpClientFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Do(req)
+			observe(req, resp, err, time.Since(start))
+			return resp, err
+		})
+	}
+}
+
+// LoggingMiddleware logs every request with its status code and duration
+// successful requests are logged at debug level, failures at warn level
+func LoggingMiddleware(logger *slog.Logger) Middleware {
+	return TimingMiddleware(func(req *http.Request, resp *http.Response, err error, duration time.Duration) {
+		attrs := []slog.Attr{
+			slog.String("method", req.Method),
+			slog.String("url", RedactURL(req.URL)),
+			slog.Duration("duration", duration),
+		}
+		level := slog.LevelDebug
+		if err != nil {
+			level = slog.LevelWarn
+			attrs = append(attrs, slog.String("error", err.Error()))
+		} else {
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				level = slog.LevelWarn
+			}
+			attrs = append(attrs, slog.Int("status", resp.StatusCode))
+		}
+		logger.LogAttrs(req.Context(), level, "http request", attrs...)
+	})
+}
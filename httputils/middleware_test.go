@@ -0,0 +1,111 @@
+package httputils
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	tracer := func(name string) Middleware {
+		return func(next IHttpClient) IHttpClient {
+			return HttpClientFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.Do(req)
+			})
+		}
+	}
+	httpClient := &mockHttpClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			order = append(order, "client")
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		},
+	}
+
+	chained := Chain(httpClient, tracer("first"), tracer("second"))
+	_, err := HttpGet(chained, "http://example.com", nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second", "client"}, order)
+}
+
+func TestHeaderMiddlewares(t *testing.T) {
+	var received http.Header
+	httpClient := &mockHttpClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			received = req.Header
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		},
+	}
+
+	chained := Chain(httpClient,
+		DefaultHeadersMiddleware(map[string]string{"Content-Type": "application/json", "X-Tenant": "a"}),
+		UserAgentMiddleware("armo-agent/1.0"),
+		RequestIDMiddleware(""),
+	)
+
+	t.Run("headers are set", func(t *testing.T) {
+		_, err := HttpGet(chained, "http://example.com", nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "application/json", received.Get("Content-Type"))
+		assert.Equal(t, "a", received.Get("X-Tenant"))
+		assert.Equal(t, "armo-agent/1.0", received.Get("User-Agent"))
+		assert.Len(t, received.Get(DefaultRequestIDHeader), 32)
+	})
+
+	t.Run("request headers take precedence", func(t *testing.T) {
+		req, _ := http.NewRequest("GET", "http://example.com", nil)
+		req.Header.Set("X-Tenant", "b")
+		req.Header.Set(DefaultRequestIDHeader, "my-id")
+
+		_, err := chained.Do(req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "b", received.Get("X-Tenant"))
+		assert.Equal(t, "my-id", received.Get(DefaultRequestIDHeader))
+		// the caller's request is not modified
+		assert.Equal(t, "", req.Header.Get("User-Agent"))
+	})
+}
+
+func TestTimingAndLoggingMiddlewares(t *testing.T) {
+	httpClient := &mockHttpClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			if req.Method == "DELETE" {
+				return nil, fmt.Errorf("connection refused")
+			}
+			time.Sleep(10 * time.Millisecond)
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		},
+	}
+
+	var observed time.Duration
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	chained := Chain(httpClient,
+		LoggingMiddleware(logger),
+		TimingMiddleware(func(req *http.Request, resp *http.Response, err error, duration time.Duration) {
+			observed = duration
+		}),
+	)
+
+	_, err := HttpGet(chained, "http://example.com?token=secret", nil)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, observed, 10*time.Millisecond)
+	assert.Contains(t, logs.String(), "level=DEBUG")
+	assert.Contains(t, logs.String(), "status=200")
+	assert.Contains(t, logs.String(), "token=xxxxx")
+	assert.NotContains(t, logs.String(), "secret")
+
+	_, err = HttpDelete(chained, "http://example.com", nil)
+	assert.Error(t, err)
+	assert.Contains(t, logs.String(), "level=WARN")
+	assert.Contains(t, logs.String(), "connection refused")
+}
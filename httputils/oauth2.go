@@ -0,0 +1,160 @@
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxTokenResponseSize limits the size of a token endpoint response
+const maxTokenResponseSize = 1 << 20
+
+// ClientAuthStyle is how the client credentials are sent to the token endpoint
+type ClientAuthStyle int
+
+const (
+	// ClientAuthBasic sends the client ID and secret in a basic Authorization header
+	ClientAuthBasic ClientAuthStyle = iota
+	// ClientAuthForm sends the client ID and secret as client_id and client_secret form parameters
+	ClientAuthForm
+)
+
+// ClientCredentialsConfig configures the OAuth2 client credentials flow
+type ClientCredentialsConfig struct {
+	// TokenURL is the URL of the token endpoint of the identity provider
+	TokenURL string
+	// ClientID is the client identifier
+	ClientID string
+	// ClientSecret is the client secret
+	ClientSecret string
+	// Scopes are the requested scopes, sent space separated in the scope parameter
+	Scopes []string
+	// Audience is sent in the audience parameter when set
+	Audience string
+	// AuthStyle is how the client credentials are sent, the zero value is ClientAuthBasic
+	AuthStyle ClientAuthStyle
+	// EndpointParams are additional form parameters sent to the token endpoint
+	EndpointParams map[string]string
+	// HttpClient is the client used to call the token endpoint, nil means a NewClient limiting each token request to 10 seconds,
+	// a hanging identity provider would otherwise block every caller waiting for the cached token
+	HttpClient IHttpClient
+	// RetryPolicy is applied to the token requests, nil retries only transport errors, 429 and 5xx responses for up to 10 seconds,
+	// since a 4xx token error (e.g. invalid_scope or invalid_grant) does not go away by retrying
+	RetryPolicy *RetryPolicy
+}
+
+// tokenRequestMaxElapsedTime bounds the retries of the default token request policy,
+// the callers of a CachingTokenSource wait for the token request
+const tokenRequestMaxElapsedTime = 10 * time.Second
+
+// tokenRequestTimeout limits a single token request of the default token endpoint client
+const tokenRequestTimeout = 10 * time.Second
+
+// defaultTokenHttpClient is the client of the token endpoint when ClientCredentialsConfig.HttpClient is nil
+func defaultTokenHttpClient() IHttpClient {
+	return NewClient(WithTimeout(tokenRequestTimeout))
+}
+
+// defaultTokenRetryPolicy is the policy of the token requests when ClientCredentialsConfig.RetryPolicy is nil
+func defaultTokenRetryPolicy() *RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.MaxElapsedTime = tokenRequestMaxElapsedTime
+	policy.ShouldRetry = func(resp *http.Response) bool {
+		return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	}
+	return policy
+}
+
+// tokenResponse is the successful response of a token endpoint (RFC 6749 section 5.1)
+type tokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	TokenType   string      `json:"token_type"`
+	ExpiresIn   json.Number `json:"expires_in"`
+}
+
+// ClientCredentialsTokenSource returns a TokenSource requesting a new token from the token endpoint on every call,
+// wrap it with NewCachingTokenSource or use ClientCredentialsMiddleware to reuse the tokens until they expire
+func ClientCredentialsTokenSource(config ClientCredentialsConfig) TokenSource {
+	if config.HttpClient == nil {
+		config.HttpClient = defaultTokenHttpClient()
+	}
+	return TokenSourceFunc(func(ctx context.Context) (*Token, error) {
+		return requestClientCredentialsToken(ctx, &config)
+	})
+}
+
+// ClientCredentialsMiddleware authenticates every request with a token of the OAuth2 client credentials flow,
+// the token is cached and renewed before it expires, see BearerTokenMiddleware
+func ClientCredentialsMiddleware(config ClientCredentialsConfig) Middleware {
+	return BearerTokenMiddleware(NewCachingTokenSource(ClientCredentialsTokenSource(config), DefaultTokenRefreshBefore))
+}
+
+func requestClientCredentialsToken(ctx context.Context, config *ClientCredentialsConfig) (*Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(config.Scopes) > 0 {
+		form.Set("scope", strings.Join(config.Scopes, " "))
+	}
+	if config.Audience != "" {
+		form.Set("audience", config.Audience)
+	}
+	for k, v := range config.EndpointParams {
+		form.Set(k, v)
+	}
+	headers := map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+		"Accept":       jsonContentType,
+	}
+	if config.AuthStyle == ClientAuthForm {
+		form.Set("client_id", config.ClientID)
+		form.Set("client_secret", config.ClientSecret)
+	} else {
+		// RFC 6749 section 2.3.1 requires the credentials to be form encoded before the basic encoding
+		req := http.Request{Header: http.Header{}}
+		req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+		headers["Authorization"] = req.Header.Get("Authorization")
+	}
+
+	policy := config.RetryPolicy
+	if policy == nil {
+		policy = defaultTokenRetryPolicy()
+	}
+	resp, err := HttpPostWithPolicy(ctx, config.HttpClient, config.TokenURL, headers, []byte(form.Encode()), policy)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	body, err := HttpRespToBytesWithLimit(resp, maxTokenResponseSize)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+
+	var tokenResp tokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, errors.New("token response has no access_token")
+	}
+	token := &Token{
+		AccessToken: tokenResp.AccessToken,
+		TokenType:   tokenResp.TokenType,
+	}
+	if strings.EqualFold(token.TokenType, "bearer") {
+		token.TokenType = "Bearer"
+	}
+	if tokenResp.ExpiresIn != "" {
+		expiresIn, err := tokenResp.ExpiresIn.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid expires_in '%s' in token response: %w", tokenResp.ExpiresIn, err)
+		}
+		if expiresIn > 0 {
+			token.Expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+		}
+	}
+	return token, nil
+}
@@ -0,0 +1,155 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestIdentityProvider(t *testing.T, tokenRequests *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		clientID, clientSecret, ok := r.BasicAuth()
+		if ok {
+			clientID, _ = url.QueryUnescape(clientID)
+			clientSecret, _ = url.QueryUnescape(clientSecret)
+		} else {
+			clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+		}
+		if r.PostForm.Get("grant_type") != "client_credentials" || clientID != "my client" || clientSecret != "s3cr=t" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+		n := tokenRequests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d-%s-%s","token_type":"bearer","expires_in":3600}`, n, r.PostForm.Get("scope"), r.PostForm.Get("audience"))
+	}))
+}
+
+func TestClientCredentialsTokenSource(t *testing.T) {
+	var tokenRequests atomic.Int32
+	idp := newTestIdentityProvider(t, &tokenRequests)
+	defer idp.Close()
+
+	config := ClientCredentialsConfig{
+		TokenURL:     idp.URL,
+		ClientID:     "my client",
+		ClientSecret: "s3cr=t",
+		Scopes:       []string{"read", "write"},
+		Audience:     "backend",
+		HttpClient:   idp.Client(),
+		RetryPolicy:  NoRetryPolicy(),
+	}
+
+	t.Run("basic auth", func(t *testing.T) {
+		token, err := ClientCredentialsTokenSource(config).Token(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "token-1-read write-backend", token.AccessToken)
+		assert.Equal(t, "Bearer", token.TokenType)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), token.Expiry, time.Minute)
+	})
+
+	t.Run("form auth", func(t *testing.T) {
+		formConfig := config
+		formConfig.AuthStyle = ClientAuthForm
+		token, err := ClientCredentialsTokenSource(formConfig).Token(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "token-2-read write-backend", token.AccessToken)
+	})
+
+	t.Run("invalid client", func(t *testing.T) {
+		badConfig := config
+		badConfig.ClientSecret = "wrong"
+		_, err := ClientCredentialsTokenSource(badConfig).Token(context.Background())
+		assert.True(t, IsAuthError(err))
+		assert.Contains(t, err.Error(), "invalid_client")
+	})
+}
+
+func TestClientCredentialsMiddleware(t *testing.T) {
+	var tokenRequests atomic.Int32
+	idp := newTestIdentityProvider(t, &tokenRequests)
+	defer idp.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1-read-" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer api.Close()
+
+	httpClient := Chain(api.Client(), ClientCredentialsMiddleware(ClientCredentialsConfig{
+		TokenURL:     idp.URL,
+		ClientID:     "my client",
+		ClientSecret: "s3cr=t",
+		Scopes:       []string{"read"},
+		HttpClient:   idp.Client(),
+	}))
+
+	for i := 0; i < 3; i++ {
+		resp, err := HttpGet(httpClient, api.URL, nil)
+		assert.NoError(t, err)
+		body, err := HttpRespToString(resp)
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", body)
+	}
+	assert.Equal(t, int32(1), tokenRequests.Load())
+}
+
+func TestClientCredentialsTokenErrorIsNotRetried(t *testing.T) {
+	var tokenRequests atomic.Int32
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":"invalid_scope"}`)
+	}))
+	defer idp.Close()
+
+	start := time.Now()
+	_, err := ClientCredentialsTokenSource(ClientCredentialsConfig{
+		TokenURL:   idp.URL,
+		ClientID:   "my client",
+		Scopes:     []string{"unknown"},
+		HttpClient: idp.Client(),
+	}).Token(context.Background())
+
+	var httpErr *HTTPError
+	assert.True(t, errors.As(err, &httpErr))
+	assert.Equal(t, http.StatusBadRequest, httpErr.StatusCode)
+	assert.Contains(t, err.Error(), "invalid_scope")
+	assert.Equal(t, int32(1), tokenRequests.Load())
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestDefaultTokenRetryPolicy(t *testing.T) {
+	policy := defaultTokenRetryPolicy()
+	assert.Equal(t, tokenRequestMaxElapsedTime, policy.MaxElapsedTime)
+	for status, want := range map[int]bool{
+		http.StatusBadRequest:          false,
+		http.StatusUnauthorized:        false,
+		http.StatusTooManyRequests:     true,
+		http.StatusInternalServerError: true,
+		http.StatusServiceUnavailable:  true,
+	} {
+		assert.Equal(t, want, policy.shouldRetry(&http.Response{StatusCode: status}), status)
+	}
+}
+
+func TestDefaultTokenHttpClient(t *testing.T) {
+	httpClient, ok := defaultTokenHttpClient().(*http.Client)
+	assert.True(t, ok)
+	assert.Equal(t, tokenRequestTimeout, httpClient.Timeout)
+	assert.Equal(t, DefaultResponseHeaderTimeout, httpClient.Transport.(*http.Transport).ResponseHeaderTimeout)
+}
@@ -0,0 +1,265 @@
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// NextPageFunc returns the URL of the page following the page fetched from current, nil means it was the last page
+// header is the header of the response of the current page
+type NextPageFunc[T any] func(current *url.URL, header http.Header, page T) (*url.URL, error)
+
+// LinkHeaderNextPage follows the rel="next" link of the RFC 5988 Link header, relative links are resolved against the current URL
+func LinkHeaderNextPage[T any]() NextPageFunc[T] {
+	return func(current *url.URL, header http.Header, _ T) (*url.URL, error) {
+		next, ok := parseLinkHeader(header.Values("Link"))["next"]
+		if !ok {
+			return nil, nil
+		}
+		nextURL, err := url.Parse(next)
+		if err != nil {
+			return nil, fmt.Errorf("invalid next link '%s': %w", next, err)
+		}
+		return current.ResolveReference(nextURL), nil
+	}
+}
+
+// CursorNextPage sets the query parameter param of the current URL to the cursor returned by cursor, e.g. a nextCursor field
+// an empty cursor means it was the last page
+func CursorNextPage[T any](param string, cursor func(page T) string) NextPageFunc[T] {
+	return func(current *url.URL, _ http.Header, page T) (*url.URL, error) {
+		next := cursor(page)
+		if next == "" {
+			return nil, nil
+		}
+		return withQueryParam(current, param, next), nil
+	}
+}
+
+// OffsetNextPage advances the query parameter offsetParam of the current URL (0 when missing) by the number of items of the page
+// a page with less than limit items means it was the last page, the limit parameter itself is expected in the first URL
+func OffsetNextPage[T any](offsetParam string, limit int, count func(page T) int) NextPageFunc[T] {
+	return func(current *url.URL, _ http.Header, page T) (*url.URL, error) {
+		n := count(page)
+		if n == 0 || n < limit {
+			return nil, nil
+		}
+		offset := 0
+		if value := current.Query().Get(offsetParam); value != "" {
+			var err error
+			if offset, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid offset '%s': %w", value, err)
+			}
+		}
+		return withQueryParam(current, offsetParam, strconv.Itoa(offset+n)), nil
+	}
+}
+
+// PaginatorConfig configures a Paginator
+type PaginatorConfig[T any] struct {
+	// URL is the URL of the first page
+	URL string
+	// Headers are set on every request, Accept defaults to application/json
+	Headers map[string]string
+	// NextPage extracts the URL of the next page
+	NextPage NextPageFunc[T]
+	// RetryPolicy is applied to the request of every page, nil means DefaultRetryPolicy
+	RetryPolicy *RetryPolicy
+	// MaxPages stops the iteration after that many pages, 0 means unlimited
+	MaxPages int
+}
+
+// Paginator fetches the pages of a paginated JSON API one by one and decodes each of them into T
+// iterate with Next and Page, then check Err:
+//
+//	for p.Next() {
+//		page := p.Page()
+//	}
+//	if err := p.Err(); err != nil {
+//	}
+type Paginator[T any] struct {
+	ctx        context.Context
+	httpClient IHttpClient
+	config     PaginatorConfig[T]
+	next       *url.URL
+	pages      int
+	page       T
+	err        error
+}
+
+// NewPaginator returns a Paginator starting at config.URL, the pages are fetched lazily by Next
+func NewPaginator[T any](ctx context.Context, httpClient IHttpClient, config PaginatorConfig[T]) *Paginator[T] {
+	p := &Paginator[T]{
+		ctx:        ctx,
+		httpClient: httpClient,
+		config:     config,
+	}
+	p.next, p.err = url.Parse(config.URL)
+	if p.err == nil && config.NextPage == nil {
+		p.err = errors.New("paginator requires a NextPage function")
+	}
+	return p
+}
+
+// Next fetches the next page, it returns false after the last page, on error or when the context is done
+func (p *Paginator[T]) Next() bool {
+	if p.err != nil || p.next == nil {
+		return false
+	}
+	if p.config.MaxPages > 0 && p.pages >= p.config.MaxPages {
+		return false
+	}
+	if err := p.ctx.Err(); err != nil {
+		p.err = err
+		return false
+	}
+
+	current := p.next
+	page, header, err := p.fetch(current.String())
+	if err != nil {
+		p.err = err
+		return false
+	}
+	next, err := p.config.NextPage(current, header, page)
+	if err != nil {
+		p.err = fmt.Errorf("failed to get the next page: %w", err)
+		return false
+	}
+	if next != nil && next.String() == current.String() {
+		p.err = fmt.Errorf("next page URL '%s' is the same as the current page URL", RedactURL(next))
+		return false
+	}
+	p.next = next
+	p.page = page
+	p.pages++
+	return true
+}
+
+// Page returns the page fetched by the last call to Next
+func (p *Paginator[T]) Page() T {
+	return p.page
+}
+
+// Err returns the error that stopped the iteration, if any
+func (p *Paginator[T]) Err() error {
+	return p.err
+}
+
+func (p *Paginator[T]) fetch(pageURL string) (T, http.Header, error) {
+	var page T
+
+	headers := map[string]string{"Accept": jsonContentType}
+	for k, v := range p.config.Headers {
+		headers[http.CanonicalHeaderKey(k)] = v
+	}
+	resp, err := httpDoWithRetry(p.ctx, p.httpClient, "GET", pageURL, headers, nil, p.config.RetryPolicy)
+	if err != nil {
+		return page, nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return page, nil, httpErrorFromResponse(nil, resp)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&page); err != nil && !errors.Is(err, io.EOF) {
+		return page, nil, fmt.Errorf("failed to decode page: %w", err)
+	}
+	return page, resp.Header, nil
+}
+
+// ItemIterator iterates over the items of the pages of a Paginator
+type ItemIterator[P, I any] struct {
+	pages *Paginator[P]
+	items func(page P) []I
+	buf   []I
+	value I
+}
+
+// NewItemIterator returns an iterator over the items returned by items for every page of pages
+func NewItemIterator[P, I any](pages *Paginator[P], items func(page P) []I) *ItemIterator[P, I] {
+	return &ItemIterator[P, I]{
+		pages: pages,
+		items: items,
+	}
+}
+
+// Next moves to the next item, fetching pages as needed, it returns false after the last item or on error
+func (it *ItemIterator[P, I]) Next() bool {
+	for len(it.buf) == 0 {
+		if !it.pages.Next() {
+			return false
+		}
+		it.buf = it.items(it.pages.Page())
+	}
+	it.value = it.buf[0]
+	it.buf = it.buf[1:]
+	return true
+}
+
+// Value returns the item of the last call to Next
+func (it *ItemIterator[P, I]) Value() I {
+	return it.value
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *ItemIterator[P, I]) Err() error {
+	return it.pages.Err()
+}
+
+// parseLinkHeader returns the URLs of the RFC 5988 Link header values by relation type
+func parseLinkHeader(values []string) map[string]string {
+	links := map[string]string{}
+	for _, value := range values {
+		for {
+			start := strings.IndexByte(value, '<')
+			if start < 0 {
+				break
+			}
+			end := strings.IndexByte(value[start:], '>')
+			if end < 0 {
+				break
+			}
+			link := value[start+1 : start+end]
+			value = value[start+end+1:]
+
+			params := value
+			if next := strings.IndexByte(value, '<'); next >= 0 {
+				params = value[:next]
+			}
+			for _, param := range strings.Split(params, ";") {
+				name, rel, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(name), "rel") {
+					continue
+				}
+				// a link can have several space separated relation types
+				for _, r := range strings.Fields(strings.Trim(strings.TrimSpace(rel), `",`)) {
+					if _, exists := links[strings.ToLower(r)]; !exists {
+						links[strings.ToLower(r)] = link
+					}
+				}
+			}
+		}
+	}
+	return links
+}
+
+// withQueryParam returns a copy of u with the query parameter set to value
+func withQueryParam(u *url.URL, param, value string) *url.URL {
+	next := *u
+	query := next.Query()
+	query.Set(param, value)
+	next.RawQuery = query.Encode()
+	return &next
+}
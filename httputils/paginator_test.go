@@ -0,0 +1,223 @@
+package httputils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type paginatorTestPage struct {
+	Items      []int  `json:"items"`
+	NextCursor string `json:"nextCursor"`
+}
+
+func TestPaginator(t *testing.T) {
+	const total = 7
+	const limit = 3
+	pageItems := func(offset int) []int {
+		var items []int
+		for i := offset; i < total && i < offset+limit; i++ {
+			items = append(items, i)
+		}
+		return items
+	}
+
+	t.Run("link header", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			if offset+limit < total {
+				w.Header().Set("Link", fmt.Sprintf(`</items?offset=%d>; rel="next", </items?offset=6>; rel="last"`, offset+limit))
+			}
+			fmt.Fprintf(w, `{"items":%s}`, jsonInts(pageItems(offset)))
+		}))
+		defer server.Close()
+
+		p := NewPaginator(context.Background(), server.Client(), PaginatorConfig[paginatorTestPage]{
+			URL:      server.URL + "/items",
+			NextPage: LinkHeaderNextPage[paginatorTestPage](),
+		})
+		it := NewItemIterator(p, func(page paginatorTestPage) []int { return page.Items })
+		var got []int
+		for it.Next() {
+			got = append(got, it.Value())
+		}
+		assert.NoError(t, it.Err())
+		assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6}, got)
+	})
+
+	t.Run("cursor", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			offset, _ := strconv.Atoi(r.URL.Query().Get("cursor"))
+			next := ""
+			if offset+limit < total {
+				next = strconv.Itoa(offset + limit)
+			}
+			fmt.Fprintf(w, `{"items":%s,"nextCursor":"%s"}`, jsonInts(pageItems(offset)), next)
+		}))
+		defer server.Close()
+
+		p := NewPaginator(context.Background(), server.Client(), PaginatorConfig[paginatorTestPage]{
+			URL:      server.URL + "/items",
+			NextPage: CursorNextPage("cursor", func(page paginatorTestPage) string { return page.NextCursor }),
+		})
+		var pages [][]int
+		for p.Next() {
+			pages = append(pages, p.Page().Items)
+		}
+		assert.NoError(t, p.Err())
+		assert.Equal(t, [][]int{{0, 1, 2}, {3, 4, 5}, {6}}, pages)
+	})
+
+	t.Run("offset with retries and max pages", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 2 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			assert.Equal(t, strconv.Itoa(limit), r.URL.Query().Get("limit"))
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			fmt.Fprint(w, jsonInts(pageItems(offset)))
+		}))
+		defer server.Close()
+
+		policy := fastRetryPolicy()
+		policy.ShouldRetry = nil
+		p := NewPaginator(context.Background(), server.Client(), PaginatorConfig[[]int]{
+			URL:         server.URL + "/items?limit=" + strconv.Itoa(limit),
+			NextPage:    OffsetNextPage("offset", limit, func(page []int) int { return len(page) }),
+			RetryPolicy: policy,
+			MaxPages:    2,
+		})
+		var pages [][]int
+		for p.Next() {
+			pages = append(pages, p.Page())
+		}
+		assert.NoError(t, p.Err())
+		assert.Equal(t, [][]int{{0, 1, 2}, {3, 4, 5}}, pages)
+		assert.Equal(t, 3, requests)
+	})
+
+	t.Run("lower case header overrides the default", func(t *testing.T) {
+		var accepts []string
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				accepts = append(accepts, req.Header.Get("Accept"))
+				return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("[]"))}, nil
+			},
+		}
+		for i := 0; i < 20; i++ {
+			p := NewPaginator(context.Background(), httpClient, PaginatorConfig[[]int]{
+				URL:      "http://example.com/items",
+				Headers:  map[string]string{"accept": "application/vnd.armo+json"},
+				NextPage: LinkHeaderNextPage[[]int](),
+			})
+			for p.Next() {
+			}
+			assert.NoError(t, p.Err())
+		}
+		for _, accept := range accepts {
+			assert.Equal(t, "application/vnd.armo+json", accept)
+		}
+	})
+
+	t.Run("http error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "nope", http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		p := NewPaginator(context.Background(), server.Client(), PaginatorConfig[[]int]{
+			URL:         server.URL,
+			NextPage:    LinkHeaderNextPage[[]int](),
+			RetryPolicy: NoRetryPolicy(),
+		})
+		assert.False(t, p.Next())
+		assert.True(t, IsNotFound(p.Err()))
+	})
+
+	t.Run("context cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cancel()
+			fmt.Fprint(w, `{"nextCursor":"next"}`)
+		}))
+		defer server.Close()
+
+		p := NewPaginator(ctx, server.Client(), PaginatorConfig[paginatorTestPage]{
+			URL:      server.URL,
+			NextPage: CursorNextPage("cursor", func(page paginatorTestPage) string { return page.NextCursor }),
+		})
+		for p.Next() {
+		}
+		assert.ErrorIs(t, p.Err(), context.Canceled)
+	})
+
+	t.Run("same next page", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Link", `<`+r.URL.String()+`>; rel="next"`)
+			fmt.Fprint(w, `[]`)
+		}))
+		defer server.Close()
+
+		p := NewPaginator(context.Background(), server.Client(), PaginatorConfig[[]int]{
+			URL:      server.URL + "/items",
+			NextPage: LinkHeaderNextPage[[]int](),
+		})
+		assert.False(t, p.Next())
+		assert.Error(t, p.Err())
+	})
+}
+
+func TestParseLinkHeader(t *testing.T) {
+	links := parseLinkHeader([]string{
+		`<https://api.example.com/items?page=2&a=1,2>; rel="next", <https://api.example.com/items?page=1>; rel="prev first"`,
+		`<https://api.example.com/items?page=9>; title="last page"; rel=last`,
+	})
+	assert.Equal(t, map[string]string{
+		"next":  "https://api.example.com/items?page=2&a=1,2",
+		"prev":  "https://api.example.com/items?page=1",
+		"first": "https://api.example.com/items?page=1",
+		"last":  "https://api.example.com/items?page=9",
+	}, links)
+
+	assert.Empty(t, parseLinkHeader(nil))
+}
+
+func TestOffsetNextPage(t *testing.T) {
+	nextPage := OffsetNextPage("offset", 2, func(page []int) int { return len(page) })
+	current, _ := url.Parse("https://api.example.com/items?limit=2&offset=4")
+
+	next, err := nextPage(current, nil, []int{1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "6", next.Query().Get("offset"))
+	assert.Equal(t, "4", current.Query().Get("offset"))
+
+	next, err = nextPage(current, nil, []int{1})
+	assert.NoError(t, err)
+	assert.Nil(t, next)
+
+	current, _ = url.Parse("https://api.example.com/items?offset=x")
+	_, err = nextPage(current, nil, []int{1, 2})
+	assert.Error(t, err)
+}
+
+func jsonInts(ints []int) string {
+	s := "["
+	for i, v := range ints {
+		if i > 0 {
+			s += ","
+		}
+		s += strconv.Itoa(v)
+	}
+	return s + "]"
+}
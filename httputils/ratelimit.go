@@ -0,0 +1,201 @@
+package httputils
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimiterConfig configures a RateLimiter, a zero rate disables the corresponding limit
+type RateLimiterConfig struct {
+	// Rate is the number of requests per second allowed for all hosts together
+	Rate float64
+	// Burst is the number of requests that can be sent at once above Rate, values below 1 mean 1
+	Burst int
+	// PerHostRate is the number of requests per second allowed for every host
+	PerHostRate float64
+	// PerHostBurst is the number of requests that can be sent at once to a host above PerHostRate, values below 1 mean 1
+	PerHostBurst int
+	// Adaptive halves the rates on every 429 response (down to MinRateRatio of the configured rates)
+	// and recovers them by a twentieth of the configured rates on every successful response
+	Adaptive bool
+	// MinRateRatio is the lowest fraction of the configured rates the adaptive mode can go down to, 0 means 0.1
+	MinRateRatio float64
+}
+
+// RateLimiter is an IHttpClient that delays requests to respect client-side token bucket limits
+type RateLimiter struct {
+	httpClient IHttpClient
+	config     RateLimiterConfig
+	global     *tokenBucket
+	mutex      sync.Mutex
+	hosts      map[string]*tokenBucket
+}
+
+var _ IHttpClient = &RateLimiter{}
+
+// NewRateLimiter wraps httpClient with global and per-host rate limits
+func NewRateLimiter(httpClient IHttpClient, config RateLimiterConfig) *RateLimiter {
+	if config.MinRateRatio <= 0 {
+		config.MinRateRatio = 0.1
+	}
+	rl := &RateLimiter{
+		httpClient: httpClient,
+		config:     config,
+		hosts:      map[string]*tokenBucket{},
+	}
+	if config.Rate > 0 {
+		rl.global = newTokenBucket(config.Rate, config.Burst, config.MinRateRatio)
+	}
+	return rl
+}
+
+// RateLimitMiddleware returns a Middleware wrapping the client with NewRateLimiter
+func RateLimitMiddleware(config RateLimiterConfig) Middleware {
+	return func(next IHttpClient) IHttpClient {
+		return NewRateLimiter(next, config)
+	}
+}
+
+// Do waits for the rate limits before sending the request, it returns the context error if the request context is done first
+func (rl *RateLimiter) Do(req *http.Request) (*http.Response, error) {
+	buckets := rl.bucketsFor(req)
+	for i, b := range buckets {
+		if err := b.wait(req.Context()); err != nil {
+			// the request is not sent, the tokens already taken go back to the other requests
+			for _, taken := range buckets[:i] {
+				taken.refund()
+			}
+			closeRequestBody(req)
+			return nil, err
+		}
+	}
+
+	resp, err := rl.httpClient.Do(req)
+	if rl.config.Adaptive && err == nil {
+		for _, b := range buckets {
+			if resp.StatusCode == http.StatusTooManyRequests {
+				b.decrease()
+			} else if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				b.increase()
+			}
+		}
+	}
+	return resp, err
+}
+
+func (rl *RateLimiter) bucketsFor(req *http.Request) []*tokenBucket {
+	var buckets []*tokenBucket
+	if rl.global != nil {
+		buckets = append(buckets, rl.global)
+	}
+	if rl.config.PerHostRate > 0 {
+		rl.mutex.Lock()
+		b, ok := rl.hosts[req.URL.Host]
+		if !ok {
+			b = newTokenBucket(rl.config.PerHostRate, rl.config.PerHostBurst, rl.config.MinRateRatio)
+			rl.hosts[req.URL.Host] = b
+		}
+		rl.mutex.Unlock()
+		buckets = append(buckets, b)
+	}
+	return buckets
+}
+
+// tokenBucket is a token bucket where the tokens can go negative, a negative balance is the waiting queue
+type tokenBucket struct {
+	mutex   sync.Mutex
+	rate    float64
+	maxRate float64
+	minRate float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+}
+
+func newTokenBucket(rate float64, burst int, minRateRatio float64) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:    rate,
+		maxRate: rate,
+		minRate: rate * minRateRatio,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		last:    time.Now(),
+	}
+}
+
+// refill adds the tokens accumulated since the last call, it must be called with the mutex held
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// wait takes a token, waiting for it to be available if needed
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mutex.Lock()
+	b.refill(time.Now())
+	b.tokens--
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mutex.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		// give the token back to the requests waiting behind this one
+		b.refund()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// refund gives back a token taken by a request that is not sent
+func (b *tokenBucket) refund() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens = math.Min(b.tokens+1, b.burst)
+}
+
+// currentRate returns the current rate of the bucket
+func (b *tokenBucket) currentRate() float64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.rate
+}
+
+func (b *tokenBucket) decrease() {
+	b.setRate(func(rate float64) float64 { return rate / 2 })
+}
+
+func (b *tokenBucket) increase() {
+	b.setRate(func(rate float64) float64 { return rate + b.maxRate/20 })
+}
+
+func (b *tokenBucket) setRate(update func(rate float64) float64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refill(time.Now())
+	rate := update(b.rate)
+	if rate < b.minRate {
+		rate = b.minRate
+	}
+	if rate > b.maxRate {
+		rate = b.maxRate
+	}
+	b.rate = rate
+}
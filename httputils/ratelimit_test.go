@@ -0,0 +1,106 @@
+package httputils
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	okClient := &mockHttpClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		},
+	}
+
+	t.Run("global rate", func(t *testing.T) {
+		rl := NewRateLimiter(okClient, RateLimiterConfig{Rate: 20, Burst: 2})
+
+		start := time.Now()
+		for i := 0; i < 6; i++ {
+			_, err := HttpGet(rl, "http://example.com", nil)
+			assert.NoError(t, err)
+		}
+		// 2 requests are sent at once, the 4 others wait 50ms each
+		assert.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+	})
+
+	t.Run("per host rate", func(t *testing.T) {
+		rl := NewRateLimiter(okClient, RateLimiterConfig{PerHostRate: 10})
+
+		start := time.Now()
+		for i := 0; i < 2; i++ {
+			_, err := HttpGet(rl, "http://a.example.com", nil)
+			assert.NoError(t, err)
+			_, err = HttpGet(rl, "http://b.example.com", nil)
+			assert.NoError(t, err)
+		}
+		elapsed := time.Since(start)
+		assert.GreaterOrEqual(t, elapsed, 90*time.Millisecond)
+		assert.Less(t, elapsed, 190*time.Millisecond)
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		rl := NewRateLimiter(okClient, RateLimiterConfig{Rate: 0.1})
+		_, err := HttpGet(rl, "http://example.com", nil)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err = HttpGetWithContext(ctx, rl, "http://example.com", nil)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestRateLimiterAdaptive(t *testing.T) {
+	statusCode := http.StatusTooManyRequests
+	httpClient := &mockHttpClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: statusCode, Body: http.NoBody}, nil
+		},
+	}
+	rl := NewRateLimiter(httpClient, RateLimiterConfig{Rate: 1000, Burst: 100, Adaptive: true, MinRateRatio: 0.2})
+
+	_, _ = HttpGet(rl, "http://example.com", nil)
+	assert.Equal(t, 500.0, rl.global.currentRate())
+	for i := 0; i < 5; i++ {
+		_, _ = HttpGet(rl, "http://example.com", nil)
+	}
+	assert.Equal(t, 200.0, rl.global.currentRate())
+
+	statusCode = http.StatusOK
+	_, _ = HttpGet(rl, "http://example.com", nil)
+	assert.Equal(t, 250.0, rl.global.currentRate())
+	for i := 0; i < 50; i++ {
+		_, _ = HttpGet(rl, "http://example.com", nil)
+	}
+	assert.Equal(t, 1000.0, rl.global.currentRate())
+}
+
+func TestRateLimiterCancelledWait(t *testing.T) {
+	okClient := &mockHttpClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		},
+	}
+	rl := NewRateLimiter(okClient, RateLimiterConfig{Rate: 1, Burst: 10, PerHostRate: 0.001, PerHostBurst: 1})
+	_, err := HttpGet(rl, "http://example.com", nil)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	body := &closeRecorder{Reader: strings.NewReader("payload")}
+	req, _ := http.NewRequestWithContext(ctx, "POST", "http://example.com", body)
+	_, err = rl.Do(req)
+
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, body.closed)
+	// only the token of the first request is gone from the global bucket
+	rl.global.mutex.Lock()
+	defer rl.global.mutex.Unlock()
+	assert.InDelta(t, 9, rl.global.tokens, 0.5)
+}
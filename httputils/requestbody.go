@@ -0,0 +1,39 @@
+package httputils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+)
+
+// BodyFactory returns a new reader of the whole request body on every call, like http.Request.GetBody
+// it lets large bodies be streamed from disk or generated on the fly while the request stays retryable
+type BodyFactory func() (io.ReadCloser, error)
+
+// FileBody returns a BodyFactory opening the file at path
+func FileBody(path string) BodyFactory {
+	return func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}
+}
+
+func (f BodyFactory) newBody() func() (io.Reader, error) {
+	if f == nil {
+		return nil
+	}
+	return func() (io.Reader, error) {
+		return f()
+	}
+}
+
+// HttpDoStreamWithPolicy sends a request with the given method and a body read from getBody, and retries it according to the policy
+// getBody is called once per attempt, the body is sent with a chunked transfer encoding since its length is unknown
+func HttpDoStreamWithPolicy(ctx context.Context, httpClient IHttpClient, method, fullURL string, headers map[string]string, getBody BodyFactory, policy *RetryPolicy) (*http.Response, error) {
+	return httpDoWithRetry(ctx, httpClient, method, fullURL, headers, getBody.newBody(), policy)
+}
+
+// HttpPostStreamWithPolicy posts a body read from getBody and retries it according to the policy, see HttpDoStreamWithPolicy
+func HttpPostStreamWithPolicy(ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string, getBody BodyFactory, policy *RetryPolicy) (*http.Response, error) {
+	return httpDoWithRetry(ctx, httpClient, "POST", fullURL, headers, getBody.newBody(), policy)
+}
@@ -0,0 +1,76 @@
+package httputils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpPostStreamWithPolicy(t *testing.T) {
+	content := strings.Repeat("sbom-component\n", 10000)
+	path := filepath.Join(t.TempDir(), "sbom.json")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	t.Run("file body is sent on every attempt", func(t *testing.T) {
+		retryCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			retryCount++
+			received, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, content, string(received))
+			if retryCount == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+
+		resp, err := HttpPostStreamWithPolicy(context.Background(), server.Client(), server.URL, nil, FileBody(path), fastRetryPolicy())
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, 2, retryCount)
+	})
+
+	t.Run("request can be replayed with GetBody", func(t *testing.T) {
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				assert.Equal(t, "PUT", req.Method)
+				_, _ = io.Copy(io.Discard, req.Body)
+				replayed, err := req.GetBody()
+				assert.NoError(t, err)
+				received, err := io.ReadAll(replayed)
+				assert.NoError(t, err)
+				assert.Equal(t, "generated", string(received))
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			},
+		}
+		getBody := func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("generated")), nil
+		}
+
+		_, err := HttpDoStreamWithPolicy(context.Background(), httpClient, "PUT", "http://example.com", nil, getBody, nil)
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("body factory error is not retried", func(t *testing.T) {
+		calls := 0
+		getBody := func() (io.ReadCloser, error) {
+			calls++
+			return nil, fmt.Errorf("no such file")
+		}
+
+		_, err := HttpPostStreamWithPolicy(context.Background(), &mockHttpClient{}, "http://example.com", nil, getBody, fastRetryPolicy())
+
+		assert.ErrorContains(t, err, "failed to open request body: no such file")
+		assert.Equal(t, 1, calls)
+	})
+}
@@ -0,0 +1,280 @@
+package httputils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// RetryPolicy configures how the Http* helpers retry a request
+// Zero InitialInterval, Multiplier and MaxInterval fall back to the DefaultRetryPolicy values,
+// all the other fields are used as is
+type RetryPolicy struct {
+	// InitialInterval is the wait time before the first retry
+	InitialInterval time.Duration
+	// Multiplier is the factor by which the wait time grows after each retry
+	Multiplier float64
+	// MaxInterval caps the wait time between two retries
+	MaxInterval time.Duration
+	// RandomizationFactor is the jitter applied to every wait time, 0 disables the jitter
+	RandomizationFactor float64
+	// MaxElapsedTime stops retrying once exceeded, 0 retries forever and a negative value disables retries
+	MaxElapsedTime time.Duration
+	// MaxAttempts is the maximum number of requests sent (the first one included), 0 means unlimited
+	MaxAttempts int
+	// ShouldRetry decides whether a non 2xx response is retried, nil means every response is retried
+	ShouldRetry func(resp *http.Response) bool
+	// ShouldRetryError decides whether an error returned by the client is retried, nil means every error is retried
+	ShouldRetryError func(err error) bool
+	// Notify is called before every wait with the error of the failed attempt and the time it is going to wait
+	Notify func(err error, wait time.Duration)
+}
+
+// DefaultRetryPolicy returns the policy used by the *WithRetry helpers
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		InitialInterval:     backoff.DefaultInitialInterval,
+		Multiplier:          backoff.DefaultMultiplier,
+		MaxInterval:         backoff.DefaultMaxInterval,
+		RandomizationFactor: backoff.DefaultRandomizationFactor,
+		MaxElapsedTime:      backoff.DefaultMaxElapsedTime,
+		ShouldRetry:         defaultShouldRetry,
+	}
+}
+
+// NoRetryPolicy returns a policy that sends the request once
+func NoRetryPolicy() *RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.MaxAttempts = 1
+	return policy
+}
+
+// legacyRetryPolicy converts the maxElapsedTime and shouldRetry arguments of the *WithContext helpers to a policy
+func legacyRetryPolicy(maxElapsedTime time.Duration, shouldRetry func(resp *http.Response) bool) *RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.MaxElapsedTime = maxElapsedTime
+	policy.ShouldRetry = shouldRetry
+	return policy
+}
+
+func (p *RetryPolicy) newBackOff() backoff.BackOff {
+	expBackOff := backoff.NewExponentialBackOff()
+	if p.InitialInterval > 0 {
+		expBackOff.InitialInterval = p.InitialInterval
+	}
+	if p.Multiplier > 0 {
+		expBackOff.Multiplier = p.Multiplier
+	}
+	if p.MaxInterval > 0 {
+		expBackOff.MaxInterval = p.MaxInterval
+	}
+	expBackOff.RandomizationFactor = p.RandomizationFactor
+	expBackOff.MaxElapsedTime = p.MaxElapsedTime
+
+	if p.MaxAttempts > 0 {
+		return backoff.WithMaxRetries(expBackOff, uint64(p.MaxAttempts-1))
+	}
+	return expBackOff
+}
+
+func (p *RetryPolicy) shouldRetry(resp *http.Response) bool {
+	return p.ShouldRetry == nil || p.ShouldRetry(resp)
+}
+
+func (p *RetryPolicy) shouldRetryError(err error) bool {
+	return p.ShouldRetryError == nil || p.ShouldRetryError(err)
+}
+
+// HttpDoWithPolicy sends a request with the given method and retries it according to the policy
+// a nil policy means DefaultRetryPolicy
+func HttpDoWithPolicy(ctx context.Context, httpClient IHttpClient, method, fullURL string, headers map[string]string, body []byte, policy *RetryPolicy) (*http.Response, error) {
+	return httpDoWithRetry(ctx, httpClient, method, fullURL, headers, bytesBody(body), policy)
+}
+
+func HttpDeleteWithPolicy(ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string, policy *RetryPolicy) (*http.Response, error) {
+	return httpDoWithRetry(ctx, httpClient, "DELETE", fullURL, headers, nil, policy)
+}
+
+func HttpHeadWithPolicy(ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string, policy *RetryPolicy) (*http.Response, error) {
+	return httpDoWithRetry(ctx, httpClient, "HEAD", fullURL, headers, nil, policy)
+}
+
+func HttpGetWithPolicy(ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string, policy *RetryPolicy) (*http.Response, error) {
+	return httpDoWithRetry(ctx, httpClient, "GET", fullURL, headers, nil, policy)
+}
+
+func HttpPostWithPolicy(ctx context.Context, httpClient IHttpClient, fullURL string, headers map[string]string, body []byte, policy *RetryPolicy) (*http.Response, error) {
+	return httpDoWithRetry(ctx, httpClient, "POST", fullURL, headers, bytesBody(body), policy)
+}
+
+// ParseRetryAfter returns the wait time requested by the server in the Retry-After header
+// both the delta-seconds and the HTTP-date forms are supported, a date in the past results in a zero wait time
+func ParseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	wait := time.Until(date)
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+// isThrottled returns true for the statuses a server uses to ask the client to slow down
+func isThrottled(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// bytesBody returns the body factory of an in-memory body, or nil when there is no body
+func bytesBody(body []byte) func() (io.Reader, error) {
+	if body == nil {
+		return nil
+	}
+	return func() (io.Reader, error) {
+		return bytes.NewReader(body), nil
+	}
+}
+
+// httpDoWithRetry is the retry engine shared by all the *WithRetry and *WithPolicy helpers
+// the request is rebuilt on every attempt, with a new body from newBody, and retried with an exponential backoff as long as the policy allows it
+// when a 429 or 503 response carries a Retry-After header, the server's wait time replaces the backoff interval,
+// the engine gives up right away if that wait exceeds the rest of the policy's max elapsed time
+func httpDoWithRetry(ctx context.Context, httpClient IHttpClient, method, fullURL string, headers map[string]string, newBody func() (io.Reader, error), policy *RetryPolicy) (*http.Response, error) {
+	if policy == nil {
+		policy = DefaultRetryPolicy()
+	}
+
+	var resp *http.Response
+	var retryAfter time.Duration
+
+	// operation sends a single attempt, the returned error is wrapped with backoff.Permanent if it should not be retried
+	operation := func() error {
+		retryAfter = 0
+
+		req, err := newRequestWithBody(ctx, method, fullURL, newBody)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		setHeaders(req, headers)
+
+		resp, err = httpClient.Do(req)
+		if err != nil {
+			// an open circuit fails fast, retrying it would defeat its purpose
+			if !errors.Is(err, ErrCircuitOpen) && policy.shouldRetryError(err) {
+				return err
+			}
+			return backoff.Permanent(err)
+		}
+
+		// If the status code is not 2xx, we will retry
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			if policy.shouldRetry(resp) {
+				if isThrottled(resp) {
+					retryAfter, _ = ParseRetryAfter(resp)
+				}
+				// only close the body if we are going to retry
+				httpErr := httpErrorFromResponse(req, resp)
+				_ = resp.Body.Close()
+				return httpErr
+			}
+			// a non retryable response is returned to the caller without an error
+			return nil
+		}
+
+		return nil
+	}
+
+	retryBackOff := policy.newBackOff()
+	retryBackOff.Reset()
+	start := time.Now()
+
+	for {
+		err := operation()
+		if err == nil {
+			return resp, nil
+		}
+		var permanent *backoff.PermanentError
+		if errors.As(err, &permanent) {
+			return resp, permanent.Err
+		}
+
+		wait := retryBackOff.NextBackOff()
+		if wait == backoff.Stop {
+			return resp, err
+		}
+		if retryAfter > 0 {
+			// wait exactly as long as the server asked, a request sent earlier would be throttled again
+			if policy.MaxElapsedTime > 0 && retryAfter > policy.MaxElapsedTime-time.Since(start) {
+				return resp, err
+			}
+			wait = retryAfter
+		}
+
+		if policy.Notify != nil {
+			policy.Notify(err, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return resp, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// newRequestWithBody creates a request with a body from newBody, which is also used as the request GetBody
+// so the body can be replayed by redirects and middlewares
+func newRequestWithBody(ctx context.Context, method, fullURL string, newBody func() (io.Reader, error)) (*http.Request, error) {
+	if newBody == nil {
+		return http.NewRequestWithContext(ctx, method, fullURL, nil)
+	}
+	bodyReader, err := newBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open request body: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, fullURL, bodyReader)
+	if err != nil {
+		if closer, ok := bodyReader.(io.Closer); ok {
+			_ = closer.Close()
+		}
+		return nil, err
+	}
+	if req.GetBody == nil {
+		// http.NewRequest only sets GetBody for in-memory readers
+		req.GetBody = func() (io.ReadCloser, error) {
+			r, err := newBody()
+			if err != nil {
+				return nil, err
+			}
+			if rc, ok := r.(io.ReadCloser); ok {
+				return rc, nil
+			}
+			return io.NopCloser(r), nil
+		}
+	}
+	return req, nil
+}
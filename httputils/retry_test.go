@@ -0,0 +1,257 @@
+package httputils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func fastRetryPolicy() *RetryPolicy {
+	policy := DefaultRetryPolicy()
+	policy.InitialInterval = time.Millisecond
+	policy.MaxInterval = 5 * time.Millisecond
+	policy.MaxElapsedTime = time.Second
+	return policy
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	expBackOff, ok := policy.newBackOff().(*backoff.ExponentialBackOff)
+	assert.True(t, ok)
+	defaults := backoff.NewExponentialBackOff()
+	assert.Equal(t, defaults.InitialInterval, expBackOff.InitialInterval)
+	assert.Equal(t, defaults.Multiplier, expBackOff.Multiplier)
+	assert.Equal(t, defaults.MaxInterval, expBackOff.MaxInterval)
+	assert.Equal(t, defaults.RandomizationFactor, expBackOff.RandomizationFactor)
+	assert.Equal(t, defaults.MaxElapsedTime, expBackOff.MaxElapsedTime)
+	assert.False(t, policy.shouldRetry(&http.Response{StatusCode: http.StatusNotFound}))
+	assert.True(t, policy.shouldRetryError(fmt.Errorf("error")))
+}
+
+func TestHttpDoWithPolicy(t *testing.T) {
+	t.Run("MaxAttempts stops retrying", func(t *testing.T) {
+		policy := fastRetryPolicy()
+		policy.MaxAttempts = 3
+
+		retryCount := 0
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				retryCount++
+				return &http.Response{StatusCode: http.StatusBadGateway, Body: http.NoBody}, nil
+			},
+		}
+
+		resp, err := HttpGetWithPolicy(context.Background(), httpClient, "http://example.com", nil, policy)
+
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		assert.Equal(t, 3, retryCount)
+	})
+
+	t.Run("ShouldRetryError stops retrying", func(t *testing.T) {
+		policy := fastRetryPolicy()
+		expectedError := fmt.Errorf("permanent error")
+		policy.ShouldRetryError = func(err error) bool {
+			return err != expectedError
+		}
+
+		retryCount := 0
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				retryCount++
+				if retryCount == 1 {
+					return nil, fmt.Errorf("transient error")
+				}
+				return nil, expectedError
+			},
+		}
+
+		resp, err := HttpPostWithPolicy(context.Background(), httpClient, "http://example.com", nil, []byte("body"), policy)
+
+		assert.Equal(t, expectedError, err)
+		assert.Nil(t, resp)
+		assert.Equal(t, 2, retryCount)
+	})
+
+	t.Run("body is resent on every attempt", func(t *testing.T) {
+		expectedBody := []byte("test body")
+		retryCount := 0
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				retryCount++
+				assert.Equal(t, "PUT", req.Method)
+				assert.Equal(t, expectedBody, readRequestBody(req))
+				if retryCount < 3 {
+					return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: http.NoBody}, nil
+				}
+				return &http.Response{StatusCode: http.StatusCreated, Body: http.NoBody}, nil
+			},
+		}
+
+		resp, err := HttpDoWithPolicy(context.Background(), httpClient, "PUT", "http://example.com", nil, expectedBody, fastRetryPolicy())
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, 3, retryCount)
+	})
+
+	t.Run("NoRetryPolicy sends a single request", func(t *testing.T) {
+		retryCount := 0
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				retryCount++
+				return nil, fmt.Errorf("transient error")
+			},
+		}
+
+		_, err := HttpDeleteWithPolicy(context.Background(), httpClient, "http://example.com", nil, NoRetryPolicy())
+
+		assert.Error(t, err)
+		assert.Equal(t, 1, retryCount)
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		wantOk     bool
+		wantMin    time.Duration
+		wantMax    time.Duration
+	}{
+		{
+			name:       "missing header",
+			retryAfter: "",
+			wantOk:     false,
+		},
+		{
+			name:       "delta seconds",
+			retryAfter: "120",
+			wantOk:     true,
+			wantMin:    120 * time.Second,
+			wantMax:    120 * time.Second,
+		},
+		{
+			name:       "negative delta seconds",
+			retryAfter: "-1",
+			wantOk:     false,
+		},
+		{
+			name:       "http date",
+			retryAfter: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat),
+			wantOk:     true,
+			wantMin:    58 * time.Second,
+			wantMax:    time.Minute,
+		},
+		{
+			name:       "http date in the past",
+			retryAfter: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat),
+			wantOk:     true,
+			wantMin:    0,
+			wantMax:    0,
+		},
+		{
+			name:       "invalid value",
+			retryAfter: "tomorrow",
+			wantOk:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+			got, ok := ParseRetryAfter(resp)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.GreaterOrEqual(t, got, tt.wantMin)
+			assert.LessOrEqual(t, got, tt.wantMax)
+		})
+	}
+}
+
+func TestHttpDoWithPolicyRetryAfter(t *testing.T) {
+	throttledResponse := func(retryAfter string) *http.Response {
+		resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}, Body: http.NoBody}
+		resp.Header.Set("Retry-After", retryAfter)
+		return resp
+	}
+
+	t.Run("waits as long as the server asks", func(t *testing.T) {
+		policy := fastRetryPolicy()
+		policy.MaxElapsedTime = 5 * time.Second
+		var waits []time.Duration
+		policy.Notify = func(err error, wait time.Duration) {
+			waits = append(waits, wait)
+		}
+
+		retryCount := 0
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				retryCount++
+				if retryCount == 1 {
+					return throttledResponse("1"), nil
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			},
+		}
+
+		start := time.Now()
+		resp, err := HttpGetWithPolicy(context.Background(), httpClient, "http://example.com", nil, policy)
+
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, []time.Duration{time.Second}, waits)
+		assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+
+	t.Run("gives up when the server asks to wait beyond max elapsed time", func(t *testing.T) {
+		policy := fastRetryPolicy()
+		policy.MaxElapsedTime = 200 * time.Millisecond
+		var waits []time.Duration
+		policy.Notify = func(err error, wait time.Duration) {
+			waits = append(waits, wait)
+		}
+
+		retryCount := 0
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				retryCount++
+				return throttledResponse("3600"), nil
+			},
+		}
+
+		start := time.Now()
+		resp, err := HttpGetWithPolicy(context.Background(), httpClient, "http://example.com", nil, policy)
+
+		var httpErr *HTTPError
+		assert.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, http.StatusTooManyRequests, httpErr.StatusCode)
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, 1, retryCount)
+		assert.Empty(t, waits)
+		assert.Less(t, time.Since(start), 100*time.Millisecond)
+	})
+
+	t.Run("context cancellation interrupts the wait", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				return throttledResponse("60"), nil
+			},
+		}
+
+		_, err := HttpGetWithPolicy(ctx, httpClient, "http://example.com", nil, DefaultRetryPolicy())
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
@@ -0,0 +1,228 @@
+package httputils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSignatureHeader is the header carrying the request signature
+	DefaultSignatureHeader = "X-Signature"
+	// DefaultSignatureTimestampHeader is the header carrying the signing time in unix seconds
+	DefaultSignatureTimestampHeader = "X-Signature-Timestamp"
+	// DefaultSignatureNonceHeader is the header carrying the random nonce of the signature
+	DefaultSignatureNonceHeader = "X-Signature-Nonce"
+	// DefaultSignatureMaxSkew is the default tolerated difference between the signing time and the verification time
+	DefaultSignatureMaxSkew = 5 * time.Minute
+	// DefaultSignatureMaxBodySize is the default maximum size of a verified request body
+	DefaultSignatureMaxBodySize = 10 << 20
+)
+
+var (
+	// ErrInvalidSignature is returned when a request signature is missing or does not match
+	ErrInvalidSignature = errors.New("invalid request signature")
+	// ErrSignatureExpired is returned when the signing time of a request is outside the tolerated clock skew
+	ErrSignatureExpired = errors.New("request signature expired")
+	// ErrSignatureReplayed is returned when a signed request was already received
+	ErrSignatureReplayed = errors.New("request signature replayed")
+	// ErrEmptySecret is returned when signing or verifying with an empty secret, which anyone could forge signatures with
+	ErrEmptySecret = errors.New("empty signature secret")
+)
+
+// SignatureConfig configures SigningMiddleware and SignatureVerifier, both sides must use the same secret, headers and hash
+// the signature is the hex encoded HMAC of the method, the path with the query, the timestamp, the nonce and the body hash
+type SignatureConfig struct {
+	// Secret is the shared HMAC key, requests are neither signed nor accepted with an empty secret
+	Secret []byte
+	// SignatureHeader is the header of the signature, empty means DefaultSignatureHeader
+	SignatureHeader string
+	// TimestampHeader is the header of the signing time, empty means DefaultSignatureTimestampHeader
+	TimestampHeader string
+	// NonceHeader is the header of the nonce, empty means DefaultSignatureNonceHeader
+	NonceHeader string
+	// Hash is the hash function of the HMAC and of the body hash, nil means sha256.New
+	Hash func() hash.Hash
+	// MaxSkew is the tolerated clock skew when verifying, 0 means DefaultSignatureMaxSkew
+	MaxSkew time.Duration
+	// MaxBodySize is the maximum size of a verified request body, 0 means DefaultSignatureMaxBodySize
+	MaxBodySize int64
+}
+
+func (c SignatureConfig) withDefaults() SignatureConfig {
+	if c.SignatureHeader == "" {
+		c.SignatureHeader = DefaultSignatureHeader
+	}
+	if c.TimestampHeader == "" {
+		c.TimestampHeader = DefaultSignatureTimestampHeader
+	}
+	if c.NonceHeader == "" {
+		c.NonceHeader = DefaultSignatureNonceHeader
+	}
+	if c.Hash == nil {
+		c.Hash = sha256.New
+	}
+	if c.MaxSkew <= 0 {
+		c.MaxSkew = DefaultSignatureMaxSkew
+	}
+	if c.MaxBodySize <= 0 {
+		c.MaxBodySize = DefaultSignatureMaxBodySize
+	}
+	return c
+}
+
+// sign returns the signature of the request parts
+func (c SignatureConfig) sign(method, path, timestamp, nonce string, body []byte) string {
+	bodyHash := c.Hash()
+	bodyHash.Write(body)
+
+	mac := hmac.New(c.Hash, c.Secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", method, path, timestamp, nonce, hex.EncodeToString(bodyHash.Sum(nil)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SigningMiddleware signs every request with an HMAC of the method, path, timestamp, nonce and body hash
+// the body is read in memory to be hashed, the signed request body stays replayable
+// with an empty secret every request fails with ErrEmptySecret
+func SigningMiddleware(config SignatureConfig) Middleware {
+	config = config.withDefaults()
+	return func(next IHttpClient) IHttpClient {
+		return HttpClientFunc(func(req *http.Request) (*http.Response, error) {
+			if len(config.Secret) == 0 {
+				closeRequestBody(req)
+				return nil, ErrEmptySecret
+			}
+			var body []byte
+			if req.Body != nil && req.Body != http.NoBody {
+				var err error
+				body, err = io.ReadAll(req.Body)
+				_ = req.Body.Close()
+				if err != nil {
+					return nil, fmt.Errorf("failed to read request body to sign: %w", err)
+				}
+			}
+			req = req.Clone(req.Context())
+			if body != nil {
+				req.Body = io.NopCloser(bytes.NewReader(body))
+				req.GetBody = func() (io.ReadCloser, error) {
+					return io.NopCloser(bytes.NewReader(body)), nil
+				}
+			}
+
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			nonce := newRequestID()
+			req.Header.Set(config.TimestampHeader, timestamp)
+			req.Header.Set(config.NonceHeader, nonce)
+			req.Header.Set(config.SignatureHeader, config.sign(req.Method, req.URL.RequestURI(), timestamp, nonce, body))
+			return next.Do(req)
+		})
+	}
+}
+
+// SignatureVerifier verifies the signatures of the requests signed by SigningMiddleware
+// a nonce is accepted once within the tolerated clock skew, so replayed requests are rejected
+type SignatureVerifier struct {
+	config   SignatureConfig
+	mutex    sync.Mutex
+	nonces   map[string]time.Time
+	prunedAt time.Time
+	now      func() time.Time
+}
+
+// NewSignatureVerifier returns a SignatureVerifier for the given configuration
+func NewSignatureVerifier(config SignatureConfig) *SignatureVerifier {
+	return &SignatureVerifier{
+		config: config.withDefaults(),
+		nonces: map[string]time.Time{},
+		now:    time.Now,
+	}
+}
+
+// Verify checks the signature of req, its body is read and replaced by an in-memory copy
+// every request is rejected with ErrEmptySecret if the secret is empty
+func (v *SignatureVerifier) Verify(req *http.Request) error {
+	if len(v.config.Secret) == 0 {
+		return ErrEmptySecret
+	}
+	signature := req.Header.Get(v.config.SignatureHeader)
+	timestamp := req.Header.Get(v.config.TimestampHeader)
+	nonce := req.Header.Get(v.config.NonceHeader)
+	if signature == "" || timestamp == "" || nonce == "" {
+		return fmt.Errorf("%w: missing signature headers", ErrInvalidSignature)
+	}
+	signedAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp '%s'", ErrInvalidSignature, timestamp)
+	}
+	now := v.now()
+	if skew := now.Sub(time.Unix(signedAt, 0)); skew > v.config.MaxSkew || skew < -v.config.MaxSkew {
+		return ErrSignatureExpired
+	}
+
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err = io.ReadAll(io.LimitReader(req.Body, v.config.MaxBodySize+1))
+		_ = req.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		}
+		if int64(len(body)) > v.config.MaxBodySize {
+			return fmt.Errorf("%w: exceeds the limit of %d bytes", ErrBodyTooLarge, v.config.MaxBodySize)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := v.config.sign(req.Method, req.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	return v.useNonce(nonce, now)
+}
+
+// useNonce records the nonce until it can no longer pass the skew check, failing if it was already used
+func (v *SignatureVerifier) useNonce(nonce string, now time.Time) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if now.Sub(v.prunedAt) > v.config.MaxSkew {
+		for n, expiry := range v.nonces {
+			if now.After(expiry) {
+				delete(v.nonces, n)
+			}
+		}
+		v.prunedAt = now
+	}
+	if _, ok := v.nonces[nonce]; ok {
+		return ErrSignatureReplayed
+	}
+	// a timestamp accepted now stays within the skew for at most twice the skew
+	v.nonces[nonce] = now.Add(2 * v.config.MaxSkew)
+	return nil
+}
+
+// Middleware returns an http.Handler that rejects the requests whose signature cannot be verified,
+// with 413 for a too large body, 500 for an empty secret and 401 otherwise, before calling next
+func (v *SignatureVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := v.Verify(r); err != nil {
+			status := http.StatusUnauthorized
+			switch {
+			case errors.Is(err, ErrBodyTooLarge):
+				status = http.StatusRequestEntityTooLarge
+			case errors.Is(err, ErrEmptySecret):
+				status = http.StatusInternalServerError
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
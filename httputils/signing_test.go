@@ -0,0 +1,158 @@
+package httputils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignatureRoundTrip(t *testing.T) {
+	config := SignatureConfig{Secret: []byte("shared-secret")}
+	verifier := NewSignatureVerifier(config)
+	var received []string
+	server := httptest.NewServer(verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+	})))
+	defer server.Close()
+
+	t.Run("signed requests are accepted", func(t *testing.T) {
+		httpClient := Chain(server.Client(), SigningMiddleware(config))
+		resp, err := HttpPost(httpClient, server.URL+"/hooks?id=1", nil, []byte(`{"event":"scan"}`))
+		assert.NoError(t, err)
+		_, err = HttpRespToString(resp)
+		assert.NoError(t, err)
+
+		resp, err = HttpGet(httpClient, server.URL+"/hooks", nil)
+		assert.NoError(t, err)
+		_, err = HttpRespToString(resp)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{`{"event":"scan"}`, ""}, received)
+	})
+
+	t.Run("wrong secret is rejected", func(t *testing.T) {
+		httpClient := Chain(server.Client(), SigningMiddleware(SignatureConfig{Secret: []byte("other")}))
+		resp, err := HttpGet(httpClient, server.URL, nil)
+		assert.NoError(t, err)
+		_, err = HttpRespToString(resp)
+		assert.True(t, IsAuthError(err))
+	})
+
+	t.Run("unsigned request is rejected", func(t *testing.T) {
+		resp, err := HttpGet(server.Client(), server.URL, nil)
+		assert.NoError(t, err)
+		_, err = HttpRespToString(resp)
+		assert.True(t, IsAuthError(err))
+	})
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	config := SignatureConfig{Secret: []byte("shared-secret"), MaxSkew: time.Minute, MaxBodySize: 16}
+	var signed *http.Request
+	sign := Chain(&mockHttpClient{
+		doFunc: func(req *http.Request) (*http.Response, error) {
+			signed = req
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+		},
+	}, SigningMiddleware(config))
+	newSignedRequest := func(body string) *http.Request {
+		req, _ := http.NewRequestWithContext(context.Background(), "POST", "http://example.com/hooks?id=1", strings.NewReader(body))
+		_, err := sign.Do(req)
+		assert.NoError(t, err)
+		return signed
+	}
+	// replay returns a copy of req as received by the server
+	replay := func(req *http.Request) *http.Request {
+		copied := req.Clone(context.Background())
+		copied.Body, _ = req.GetBody()
+		return copied
+	}
+
+	t.Run("replayed request is rejected", func(t *testing.T) {
+		verifier := NewSignatureVerifier(config)
+		req := newSignedRequest("payload")
+		assert.NoError(t, verifier.Verify(replay(req)))
+		assert.ErrorIs(t, verifier.Verify(replay(req)), ErrSignatureReplayed)
+	})
+
+	t.Run("tampered body is rejected", func(t *testing.T) {
+		verifier := NewSignatureVerifier(config)
+		req := replay(newSignedRequest("payload"))
+		req.Body = io.NopCloser(strings.NewReader("tampered"))
+		assert.ErrorIs(t, verifier.Verify(req), ErrInvalidSignature)
+	})
+
+	t.Run("tampered path is rejected", func(t *testing.T) {
+		verifier := NewSignatureVerifier(config)
+		req := replay(newSignedRequest("payload"))
+		req.URL.RawQuery = "id=2"
+		assert.ErrorIs(t, verifier.Verify(req), ErrInvalidSignature)
+	})
+
+	t.Run("clock skew", func(t *testing.T) {
+		verifier := NewSignatureVerifier(config)
+		clock := &fakeClock{now: time.Now().Add(50 * time.Second)}
+		verifier.now = clock.Now
+		assert.NoError(t, verifier.Verify(replay(newSignedRequest("payload"))))
+
+		clock.now = time.Now().Add(-2 * time.Minute)
+		assert.ErrorIs(t, verifier.Verify(replay(newSignedRequest("payload"))), ErrSignatureExpired)
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		verifier := NewSignatureVerifier(config)
+		assert.ErrorIs(t, verifier.Verify(replay(newSignedRequest(strings.Repeat("x", 17)))), ErrBodyTooLarge)
+	})
+
+	t.Run("expired nonces are pruned", func(t *testing.T) {
+		verifier := NewSignatureVerifier(config)
+		assert.NoError(t, verifier.Verify(replay(newSignedRequest("payload"))))
+		assert.Len(t, verifier.nonces, 1)
+
+		assert.NoError(t, verifier.useNonce("other", time.Now().Add(3*time.Minute)))
+		assert.Len(t, verifier.nonces, 1)
+	})
+}
+
+func TestSignatureEmptySecret(t *testing.T) {
+	t.Run("requests are not signed", func(t *testing.T) {
+		var sent bool
+		httpClient := Chain(&mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				sent = true
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			},
+		}, SigningMiddleware(SignatureConfig{}))
+		body := &closeRecorder{Reader: strings.NewReader("payload")}
+		req, _ := http.NewRequestWithContext(context.Background(), "POST", "http://example.com/hooks", body)
+		_, err := httpClient.Do(req)
+		assert.ErrorIs(t, err, ErrEmptySecret)
+		assert.False(t, sent)
+		assert.True(t, body.closed)
+	})
+
+	t.Run("signatures made with an empty key are rejected", func(t *testing.T) {
+		config := SignatureConfig{}.withDefaults()
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req, _ := http.NewRequestWithContext(context.Background(), "GET", "http://example.com/hooks", nil)
+		req.Header.Set(config.TimestampHeader, timestamp)
+		req.Header.Set(config.NonceHeader, "nonce")
+		req.Header.Set(config.SignatureHeader, config.sign("GET", "/hooks", timestamp, "nonce", nil))
+
+		verifier := NewSignatureVerifier(SignatureConfig{Secret: []byte{}})
+		assert.ErrorIs(t, verifier.Verify(req), ErrEmptySecret)
+
+		w := httptest.NewRecorder()
+		verifier.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			t.Error("handler must not be called")
+		})).ServeHTTP(w, req)
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
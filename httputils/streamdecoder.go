@@ -0,0 +1,164 @@
+package httputils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrElementTooLarge is returned by JSONStreamDecoder when an element exceeds the maximum element size
+var ErrElementTooLarge = errors.New("json element exceeds the maximum element size")
+
+// JSONStreamDecoder decodes the elements of a json array or of a newline delimited json stream one by one,
+// numbers are decoded with UseNumber like JSONDecoder
+// iterate with Next and Value, then check Err:
+//
+//	for dec.Next() {
+//		v := dec.Value()
+//	}
+//	if err := dec.Err(); err != nil {
+//	}
+type JSONStreamDecoder[T any] struct {
+	reader  *elementLimitReader
+	closer  io.Closer
+	dec     *json.Decoder
+	format  StreamFormat
+	started bool
+	done    bool
+	value   T
+	err     error
+}
+
+// NewJSONStreamDecoder returns a decoder of the elements read from r in the given format
+// maxElementSize limits the bytes read for a single element (including the surrounding separators), 0 means unlimited
+func NewJSONStreamDecoder[T any](r io.Reader, format StreamFormat, maxElementSize int64) *JSONStreamDecoder[T] {
+	reader := &elementLimitReader{reader: r, maxSize: maxElementSize}
+	dec := json.NewDecoder(reader)
+	dec.UseNumber()
+	return &JSONStreamDecoder[T]{
+		reader: reader,
+		dec:    dec,
+		format: format,
+	}
+}
+
+// HttpRespToJSONStream checks the HTTP status code and returns a decoder of the elements of the response body
+// a non 2xx response is returned as an *HTTPError, the body is closed by the decoder's Close
+// like HttpRespToBytes, a nil response or body is accepted and has no elements
+func HttpRespToJSONStream[T any](resp *http.Response, format StreamFormat, maxElementSize int64) (*JSONStreamDecoder[T], error) {
+	if resp == nil || resp.Body == nil {
+		dec := NewJSONStreamDecoder[T](http.NoBody, format, maxElementSize)
+		dec.done = true
+		return dec, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer func(Body io.ReadCloser) {
+			_ = Body.Close()
+		}(resp.Body)
+		return nil, httpErrorFromResponse(nil, resp)
+	}
+	dec := NewJSONStreamDecoder[T](resp.Body, format, maxElementSize)
+	dec.closer = resp.Body
+	return dec, nil
+}
+
+// Next decodes the next element, it returns false at the end of the stream or on error
+func (d *JSONStreamDecoder[T]) Next() bool {
+	if d.err != nil || d.done {
+		return false
+	}
+	d.reader.startElement(d.dec.InputOffset())
+
+	if d.format == JSONArrayFormat {
+		if !d.started {
+			if err := d.expectDelim('['); err != nil {
+				d.err = err
+				return false
+			}
+		}
+		if !d.dec.More() {
+			if err := d.expectDelim(']'); err != nil {
+				d.err = err
+				return false
+			}
+			d.done = true
+			return false
+		}
+	}
+	d.started = true
+
+	var value T
+	if err := d.dec.Decode(&value); err != nil {
+		if d.format == NDJSONFormat && errors.Is(err, io.EOF) {
+			d.done = true
+			return false
+		}
+		d.err = err
+		return false
+	}
+	d.value = value
+	return true
+}
+
+// Value returns the element decoded by the last call to Next
+func (d *JSONStreamDecoder[T]) Value() T {
+	return d.value
+}
+
+// Err returns the error that stopped the iteration, if any
+func (d *JSONStreamDecoder[T]) Err() error {
+	return d.err
+}
+
+// Close closes the response body of a decoder returned by HttpRespToJSONStream, it is a no-op otherwise
+func (d *JSONStreamDecoder[T]) Close() error {
+	if d.closer == nil {
+		return nil
+	}
+	return d.closer.Close()
+}
+
+func (d *JSONStreamDecoder[T]) expectDelim(delim json.Delim) error {
+	token, err := d.dec.Token()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("expected '%s' in json array stream, got '%v'", delim, token)
+	}
+	return nil
+}
+
+// elementLimitReader fails with ErrElementTooLarge when more than maxSize bytes are read since the start of the current element
+type elementLimitReader struct {
+	reader  io.Reader
+	maxSize int64
+	read    int64
+	limit   int64
+}
+
+// startElement sets the limit for an element starting at the given offset
+func (r *elementLimitReader) startElement(offset int64) {
+	// one extra byte lets the decoder find the end of a number of exactly maxSize bytes
+	r.limit = offset + r.maxSize + 1
+}
+
+func (r *elementLimitReader) Read(p []byte) (int, error) {
+	if r.maxSize > 0 {
+		remaining := r.limit - r.read
+		if remaining <= 0 {
+			return 0, ErrElementTooLarge
+		}
+		if int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	return n, err
+}
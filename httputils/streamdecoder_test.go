@@ -0,0 +1,180 @@
+package httputils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONStreamDecoder(t *testing.T) {
+	type testStruct struct {
+		Name  string      `json:"name"`
+		Score interface{} `json:"score"`
+	}
+	expected := []testStruct{
+		{Name: "CVE-2016-2781", Score: json.Number("5.5")},
+		{Name: "CVE-2020-16156", Score: json.Number("7.8")},
+		{Name: "CVE-2021-39537", Score: json.Number("12345678901234567890")},
+	}
+	decodeAll := func(dec *JSONStreamDecoder[testStruct]) []testStruct {
+		var decoded []testStruct
+		for dec.Next() {
+			decoded = append(decoded, dec.Value())
+		}
+		return decoded
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		format  StreamFormat
+		want    []testStruct
+		wantErr string
+	}{
+		{
+			name:   "json array",
+			input:  ` [ {"name":"CVE-2016-2781","score":5.5},` + "\n" + `{"name":"CVE-2020-16156","score":7.8} , {"name":"CVE-2021-39537","score":12345678901234567890} ] `,
+			format: JSONArrayFormat,
+			want:   expected,
+		},
+		{
+			name:   "empty json array",
+			input:  `[]`,
+			format: JSONArrayFormat,
+		},
+		{
+			name:    "not a json array",
+			input:   `{"name":"CVE-2016-2781"}`,
+			format:  JSONArrayFormat,
+			wantErr: "expected '[' in json array stream",
+		},
+		{
+			name:    "truncated json array",
+			input:   `[{"name":"CVE-2016-2781","score":5.5},`,
+			format:  JSONArrayFormat,
+			want:    expected[:1],
+			wantErr: "unexpected end of JSON input",
+		},
+		{
+			name:    "unterminated json array",
+			input:   `[{"name":"CVE-2016-2781","score":5.5}`,
+			format:  JSONArrayFormat,
+			want:    expected[:1],
+			wantErr: "unexpected end of JSON input",
+		},
+		{
+			name:   "ndjson",
+			input:  `{"name":"CVE-2016-2781","score":5.5}` + "\n" + `{"name":"CVE-2020-16156","score":7.8}` + "\n" + `{"name":"CVE-2021-39537","score":12345678901234567890}` + "\n",
+			format: NDJSONFormat,
+			want:   expected,
+		},
+		{
+			name:   "empty ndjson",
+			input:  "",
+			format: NDJSONFormat,
+		},
+		{
+			name:    "invalid ndjson",
+			input:   `{"name":"CVE-2016-2781","score":5.5}` + "\n" + `{"name":`,
+			format:  NDJSONFormat,
+			want:    expected[:1],
+			wantErr: "unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := NewJSONStreamDecoder[testStruct](strings.NewReader(tt.input), tt.format, 0)
+			assert.Equal(t, tt.want, decodeAll(dec))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, dec.Err(), tt.wantErr)
+			} else {
+				assert.NoError(t, dec.Err())
+			}
+			assert.False(t, dec.Next())
+		})
+	}
+}
+
+func TestJSONStreamDecoderMaxElementSize(t *testing.T) {
+	element := `{"name":"` + strings.Repeat("a", 100) + `"}`
+	input := "[" + strings.Repeat(element+",", 1000) + element + "]"
+
+	dec := NewJSONStreamDecoder[map[string]string](strings.NewReader(input), JSONArrayFormat, int64(len(element)+2))
+	count := 0
+	for dec.Next() {
+		count++
+	}
+	assert.NoError(t, dec.Err())
+	assert.Equal(t, 1001, count)
+
+	tooLarge := "[" + element + "," + `{"name":"` + strings.Repeat("b", 10000) + `"}` + "]"
+	dec = NewJSONStreamDecoder[map[string]string](strings.NewReader(tooLarge), JSONArrayFormat, int64(len(element)+2))
+	count = 0
+	for dec.Next() {
+		count++
+	}
+	assert.ErrorIs(t, dec.Err(), ErrElementTooLarge)
+	assert.Equal(t, 1, count)
+}
+
+func TestHttpRespToJSONStream(t *testing.T) {
+	body := &closeRecorder{Reader: strings.NewReader("1\n2\n3\n")}
+	dec, err := HttpRespToJSONStream[int](&http.Response{StatusCode: http.StatusOK, Body: body}, NDJSONFormat, 0)
+	assert.NoError(t, err)
+	var decoded []int
+	for dec.Next() {
+		decoded = append(decoded, dec.Value())
+	}
+	assert.NoError(t, dec.Err())
+	assert.Equal(t, []int{1, 2, 3}, decoded)
+	assert.NoError(t, dec.Close())
+	assert.True(t, body.closed)
+
+	body = &closeRecorder{Reader: strings.NewReader("not found")}
+	_, err = HttpRespToJSONStream[int](&http.Response{StatusCode: http.StatusNotFound, Body: body}, NDJSONFormat, 0)
+	assert.True(t, IsNotFound(err))
+	assert.True(t, body.closed)
+
+	for _, resp := range []*http.Response{nil, {StatusCode: http.StatusOK}} {
+		dec, err = HttpRespToJSONStream[int](resp, JSONArrayFormat, 0)
+		assert.NoError(t, err)
+		assert.False(t, dec.Next())
+		assert.NoError(t, dec.Err())
+		assert.NoError(t, dec.Close())
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func BenchmarkJSONStreamDecoder(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString("[")
+	for i := 0; i < 10000; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteString(fmt.Sprintf(`{"name":"CVE-2022-%d"}`, i))
+	}
+	sb.WriteString("]")
+	input := sb.String()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dec := NewJSONStreamDecoder[map[string]string](strings.NewReader(input), JSONArrayFormat, 1024)
+		for dec.Next() {
+		}
+	}
+}
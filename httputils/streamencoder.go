@@ -0,0 +1,238 @@
+package httputils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// StreamFormat is the encoding of the elements streamed by StreamUpload
+type StreamFormat int
+
+const (
+	// JSONArrayFormat streams the elements as a json array
+	JSONArrayFormat StreamFormat = iota
+	// NDJSONFormat streams the elements as newline delimited json
+	NDJSONFormat
+)
+
+func (f StreamFormat) contentType() string {
+	if f == NDJSONFormat {
+		return "application/x-ndjson"
+	}
+	return jsonContentType
+}
+
+// StreamUploadConfig configures StreamUpload
+type StreamUploadConfig struct {
+	// URL is the URL the requests are sent to
+	URL string
+	// Method is the method of the requests, empty means POST
+	Method string
+	// Headers are set on every request, Content-Type defaults to the content type of the format
+	Headers map[string]string
+	// Format is the encoding of the request bodies
+	Format StreamFormat
+	// MaxBytes is the budget of every request body, a new request is started when the next element would exceed it
+	// a body might be bigger than MaxBytes if a single element is bigger than MaxBytes, 0 means a single request
+	MaxBytes int
+}
+
+// StreamUploadResult is the outcome of StreamUpload
+type StreamUploadResult struct {
+	// Requests is the number of requests that were completed successfully
+	Requests int
+	// Elements is the number of elements sent in the successful requests
+	Elements int
+}
+
+// StreamUpload encodes the elements received from items and streams them into request bodies through an io.Pipe,
+// so only a single encoded element is held in memory, starting a new request whenever the byte budget is reached
+// it returns once items is closed, on the first failed request or encoding error, or when ctx is done
+// the requests are not retried since a streamed body cannot be replayed
+func StreamUpload[T any](ctx context.Context, httpClient IHttpClient, items <-chan T, config StreamUploadConfig) (*StreamUploadResult, error) {
+	return streamUpload(ctx, httpClient, func() (T, bool, error) {
+		select {
+		case item, ok := <-items:
+			return item, ok, nil
+		case <-ctx.Done():
+			var zero T
+			return zero, false, ctx.Err()
+		}
+	}, config)
+}
+
+// StreamUploadSlice is StreamUpload for the elements of a slice
+func StreamUploadSlice[T any](ctx context.Context, httpClient IHttpClient, slice []T, config StreamUploadConfig) (*StreamUploadResult, error) {
+	i := 0
+	return streamUpload(ctx, httpClient, func() (T, bool, error) {
+		if i == len(slice) {
+			var zero T
+			return zero, false, nil
+		}
+		i++
+		return slice[i-1], true, ctx.Err()
+	}, config)
+}
+
+func streamUpload[T any](ctx context.Context, httpClient IHttpClient, next func() (T, bool, error), config StreamUploadConfig) (*StreamUploadResult, error) {
+	result := &StreamUploadResult{}
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	var body *streamedBody
+
+	for {
+		item, ok, err := next()
+		if err != nil {
+			if body != nil {
+				body.abort(err)
+			}
+			return result, err
+		}
+		if !ok {
+			if body != nil {
+				if err := body.finish(); err != nil {
+					return result, err
+				}
+				result.Requests++
+				result.Elements += body.elements
+			}
+			return result, nil
+		}
+
+		buf.Reset()
+		if err := enc.Encode(item); err != nil {
+			if body != nil {
+				body.abort(err)
+			}
+			return result, fmt.Errorf("failed to encode element: %w", err)
+		}
+		encoded := buf.Bytes()
+		if config.Format == JSONArrayFormat {
+			// the encoder terminates each value with a new line
+			encoded = encoded[:len(encoded)-1]
+		}
+
+		if body != nil && config.MaxBytes > 0 && body.sizeWith(len(encoded)) > config.MaxBytes {
+			if err := body.finish(); err != nil {
+				return result, err
+			}
+			result.Requests++
+			result.Elements += body.elements
+			body = nil
+		}
+		if body == nil {
+			body = startStreamedBody(ctx, httpClient, config)
+		}
+		if err := body.write(encoded); err != nil {
+			return result, err
+		}
+	}
+}
+
+// streamedBody is the body of an in-flight request, written through an io.Pipe
+type streamedBody struct {
+	format   StreamFormat
+	writer   *io.PipeWriter
+	size     int
+	elements int
+	done     chan error
+}
+
+func startStreamedBody(ctx context.Context, httpClient IHttpClient, config StreamUploadConfig) *streamedBody {
+	reader, writer := io.Pipe()
+	body := &streamedBody{
+		format: config.Format,
+		writer: writer,
+		done:   make(chan error, 1),
+	}
+	method := config.Method
+	if method == "" {
+		method = "POST"
+	}
+	go func() {
+		body.done <- sendStreamedRequest(ctx, httpClient, method, config, reader)
+		// unblock the writer if the request ended before reading the whole body
+		_ = reader.CloseWithError(io.ErrClosedPipe)
+	}()
+	return body
+}
+
+func sendStreamedRequest(ctx context.Context, httpClient IHttpClient, method string, config StreamUploadConfig, reader io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, method, config.URL, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", config.Format.contentType())
+	setHeaders(req, config.Headers)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return httpErrorFromResponse(req, resp)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// sizeWith returns the size of the complete body if an element of the given size is added
+func (b *streamedBody) sizeWith(elementSize int) int {
+	if b.format == NDJSONFormat {
+		return b.size + elementSize
+	}
+	// the separator (or the opening bracket) and the closing bracket
+	return b.size + 1 + elementSize + 1
+}
+
+func (b *streamedBody) write(encoded []byte) error {
+	var prefix []byte
+	if b.format == JSONArrayFormat {
+		prefix = []byte{','}
+		if b.elements == 0 {
+			prefix = []byte{'['}
+		}
+	}
+	for _, p := range [][]byte{prefix, encoded} {
+		if len(p) == 0 {
+			continue
+		}
+		if _, err := b.writer.Write(p); err != nil {
+			// the request ended early, its error explains why
+			if reqErr := <-b.done; reqErr != nil {
+				return reqErr
+			}
+			return err
+		}
+		b.size += len(p)
+	}
+	b.elements++
+	return nil
+}
+
+// finish completes the body and waits for the response
+func (b *streamedBody) finish() error {
+	if b.format == JSONArrayFormat {
+		if _, err := b.writer.Write([]byte{']'}); err != nil {
+			if reqErr := <-b.done; reqErr != nil {
+				return reqErr
+			}
+			return err
+		}
+	}
+	_ = b.writer.Close()
+	return <-b.done
+}
+
+// abort fails the request and waits for it to end
+func (b *streamedBody) abort(err error) {
+	_ = b.writer.CloseWithError(err)
+	<-b.done
+}
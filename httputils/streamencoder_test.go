@@ -0,0 +1,153 @@
+package httputils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamUpload(t *testing.T) {
+	type testStruct struct {
+		Name  string  `json:"name"`
+		Score float64 `json:"score"`
+	}
+	var slice []testStruct
+	for i := 0; i < 100; i++ {
+		slice = append(slice, testStruct{Name: fmt.Sprintf("CVE-2022-%04d", i)})
+	}
+
+	newServer := func(t *testing.T, format StreamFormat, maxBytes int) (*httptest.Server, func() [][]testStruct) {
+		var bodies [][]testStruct
+		mutex := sync.Mutex{}
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, len(raw), maxBytes)
+			var body []testStruct
+			if format == JSONArrayFormat {
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				assert.NoError(t, json.Unmarshal(raw, &body))
+			} else {
+				assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+				scanner := bufio.NewScanner(bytes.NewReader(raw))
+				for scanner.Scan() {
+					var v testStruct
+					assert.NoError(t, json.Unmarshal(scanner.Bytes(), &v))
+					body = append(body, v)
+				}
+			}
+			mutex.Lock()
+			bodies = append(bodies, body)
+			mutex.Unlock()
+		}))
+		return server, func() [][]testStruct {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return bodies
+		}
+	}
+
+	for _, format := range []StreamFormat{JSONArrayFormat, NDJSONFormat} {
+		t.Run(fmt.Sprintf("format %d", format), func(t *testing.T) {
+			maxBytes := 500
+			server, bodies := newServer(t, format, maxBytes)
+			defer server.Close()
+
+			result, err := StreamUploadSlice(context.Background(), server.Client(), slice, StreamUploadConfig{
+				URL:      server.URL,
+				Format:   format,
+				MaxBytes: maxBytes,
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, len(slice), result.Elements)
+			assert.Equal(t, len(bodies()), result.Requests)
+			assert.Greater(t, result.Requests, 1)
+			var received []testStruct
+			for _, body := range bodies() {
+				received = append(received, body...)
+			}
+			assert.Equal(t, slice, received)
+		})
+	}
+
+	t.Run("channel", func(t *testing.T) {
+		server, bodies := newServer(t, JSONArrayFormat, math.MaxInt)
+		defer server.Close()
+
+		items := make(chan testStruct)
+		go func() {
+			defer close(items)
+			for _, v := range slice {
+				items <- v
+			}
+		}()
+		result, err := StreamUpload(context.Background(), server.Client(), items, StreamUploadConfig{URL: server.URL})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, result.Requests)
+		assert.Equal(t, [][]testStruct{slice}, bodies())
+	})
+
+	t.Run("empty input sends no request", func(t *testing.T) {
+		result, err := StreamUploadSlice(context.Background(), &mockHttpClient{}, []testStruct{}, StreamUploadConfig{URL: "http://example.com"})
+		assert.NoError(t, err)
+		assert.Equal(t, 0, result.Requests)
+	})
+
+	t.Run("failed request", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		}))
+		defer server.Close()
+
+		_, err := StreamUploadSlice(context.Background(), server.Client(), slice, StreamUploadConfig{URL: server.URL, MaxBytes: 500})
+
+		var httpErr *HTTPError
+		assert.ErrorAs(t, err, &httpErr)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, httpErr.StatusCode)
+	})
+
+	// the aborted requests might reach the server with a truncated body
+	discardingServer := func() *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body)
+		}))
+	}
+
+	t.Run("encoding error", func(t *testing.T) {
+		server := discardingServer()
+		defer server.Close()
+		invalid := append([]testStruct{}, slice...)
+		invalid[50].Score = math.Inf(-1)
+
+		_, err := StreamUploadSlice(context.Background(), server.Client(), invalid, StreamUploadConfig{URL: server.URL})
+
+		assert.ErrorContains(t, err, "failed to encode element")
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		server := discardingServer()
+		defer server.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		items := make(chan testStruct)
+		go func() {
+			items <- slice[0]
+			cancel()
+		}()
+
+		_, err := StreamUpload(ctx, server.Client(), items, StreamUploadConfig{URL: server.URL})
+
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
@@ -0,0 +1,244 @@
+package httputils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultCertReloadInterval is how often the certificate files are checked for rotation by default
+const DefaultCertReloadInterval = time.Minute
+
+// TLSClientConfig configures the TLS of a client, the PEM contents can be given inline or as files,
+// the files are checked for rotation and reloaded without restarting the client
+type TLSClientConfig struct {
+	// CAFile is a PEM bundle of the trusted certificate authorities, it is reloaded when it changes
+	CAFile string
+	// CAPEM is a PEM bundle of the trusted certificate authorities, added to the ones of CAFile
+	CAPEM []byte
+	// UseSystemCAs adds the system certificate authorities to the trusted ones,
+	// the system ones are used anyway when neither CAFile nor CAPEM is set
+	UseSystemCAs bool
+	// CertFile and KeyFile are the PEM client certificate and key for mTLS, they are reloaded when they change
+	CertFile string
+	KeyFile  string
+	// CertPEM and KeyPEM are the PEM client certificate and key for mTLS, ignored when CertFile is set
+	CertPEM []byte
+	KeyPEM  []byte
+	// ServerName overrides the name used for SNI and to verify the server certificate,
+	// it can be an IP address, matched against the IP SANs of the server certificate
+	ServerName string
+	// MinVersion is the minimum TLS version, 0 means TLS 1.2
+	MinVersion uint16
+	// CipherSuites restricts the TLS 1.2 cipher suites, nil means the Go defaults (TLS 1.3 suites are not configurable)
+	CipherSuites []uint16
+	// ReloadInterval is the minimal time between two checks of the files for rotation, 0 means DefaultCertReloadInterval
+	ReloadInterval time.Duration
+}
+
+// NewTLSConfig returns a *tls.Config built from config
+// the rotated files are picked up by new connections, idle connections keep their certificates until they are closed
+func NewTLSConfig(config TLSClientConfig) (*tls.Config, error) {
+	tlsConfig, _, err := newTLSConfig(config)
+	return tlsConfig, err
+}
+
+func newTLSConfig(config TLSClientConfig) (*tls.Config, *certReloader, error) {
+	minVersion := config.MinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+	tlsConfig := &tls.Config{
+		ServerName:   config.ServerName,
+		MinVersion:   minVersion,
+		CipherSuites: config.CipherSuites,
+	}
+
+	reloader := &certReloader{
+		config:   config,
+		interval: config.ReloadInterval,
+		now:      time.Now,
+	}
+	if reloader.interval <= 0 {
+		reloader.interval = DefaultCertReloadInterval
+	}
+	if err := reloader.load(); err != nil {
+		return nil, nil, err
+	}
+
+	if config.CertFile != "" {
+		tlsConfig.GetClientCertificate = reloader.clientCertificate
+	} else if reloader.cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*reloader.cert}
+	}
+
+	if config.CAFile != "" {
+		// the standard verification cannot use a pool that changes, the chain is verified against the current pool instead
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = reloader.verifyConnection
+	} else if reloader.roots != nil {
+		tlsConfig.RootCAs = reloader.roots
+	}
+	return tlsConfig, reloader, nil
+}
+
+// NewTLSClient returns an *http.Client, which is an IHttpClient, using the TLS configuration and the default transport settings
+func NewTLSClient(config TLSClientConfig) (*http.Client, error) {
+	tlsConfig, err := NewTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
+
+// certReloader holds the client certificate and the trusted pool, reloading their files when they change
+type certReloader struct {
+	config    TLSClientConfig
+	interval  time.Duration
+	mutex     sync.Mutex
+	cert      *tls.Certificate
+	roots     *x509.CertPool
+	modTimes  map[string]time.Time
+	checkedAt time.Time
+	now       func() time.Time
+}
+
+// load reads the certificate and the pool, it fails if any of them is invalid
+func (r *certReloader) load() error {
+	modTimes := map[string]time.Time{}
+	for _, path := range []string{r.config.CAFile, r.config.CertFile, r.config.KeyFile} {
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to read tls file: %w", err)
+		}
+		modTimes[path] = info.ModTime()
+	}
+
+	cert, err := r.loadCertificate()
+	if err != nil {
+		return err
+	}
+	roots, err := r.loadRoots()
+	if err != nil {
+		return err
+	}
+	r.cert = cert
+	r.roots = roots
+	r.modTimes = modTimes
+	r.checkedAt = r.now()
+	return nil
+}
+
+func (r *certReloader) loadCertificate() (*tls.Certificate, error) {
+	certPEM, keyPEM := r.config.CertPEM, r.config.KeyPEM
+	if r.config.CertFile != "" {
+		var err error
+		if certPEM, err = os.ReadFile(r.config.CertFile); err != nil {
+			return nil, fmt.Errorf("failed to read client certificate: %w", err)
+		}
+		if keyPEM, err = os.ReadFile(r.config.KeyFile); err != nil {
+			return nil, fmt.Errorf("failed to read client key: %w", err)
+		}
+	}
+	if len(certPEM) == 0 && len(keyPEM) == 0 {
+		return nil, nil
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// loadRoots returns the trusted pool, nil means the system pool
+func (r *certReloader) loadRoots() (*x509.CertPool, error) {
+	if r.config.CAFile == "" && len(r.config.CAPEM) == 0 {
+		return nil, nil
+	}
+	roots := x509.NewCertPool()
+	if r.config.UseSystemCAs {
+		systemRoots, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the system certificate authorities: %w", err)
+		}
+		roots = systemRoots
+	}
+	if r.config.CAFile != "" {
+		caPEM, err := os.ReadFile(r.config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read certificate authorities: %w", err)
+		}
+		if !roots.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificate found in '%s'", r.config.CAFile)
+		}
+	}
+	if len(r.config.CAPEM) > 0 && !roots.AppendCertsFromPEM(r.config.CAPEM) {
+		return nil, errors.New("no certificate found in the certificate authorities PEM")
+	}
+	return roots, nil
+}
+
+// reload loads the files again if the reload interval elapsed and one of them changed,
+// a failed reload (e.g. a rotation in progress) keeps the previous certificates until the next check
+func (r *certReloader) reload() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := r.now()
+	if now.Sub(r.checkedAt) < r.interval {
+		return
+	}
+	r.checkedAt = now
+	for path, modTime := range r.modTimes {
+		if info, err := os.Stat(path); err == nil && !info.ModTime().Equal(modTime) {
+			_ = r.load()
+			return
+		}
+	}
+}
+
+func (r *certReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.reload()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.cert, nil
+}
+
+// verifyConnection verifies the server certificate chain and name against the current pool
+func (r *certReloader) verifyConnection(state tls.ConnectionState) error {
+	r.reload()
+	r.mutex.Lock()
+	roots := r.roots
+	r.mutex.Unlock()
+
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("tls: server did not provide a certificate")
+	}
+	serverName := state.ServerName
+	if serverName == "" {
+		// no SNI is sent for IP addresses, so the state has no name, an IP is verified against the IP SANs
+		serverName = r.config.ServerName
+	}
+	if serverName == "" {
+		return errors.New("tls: cannot verify the server name, set ServerName to the address of the server")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       serverName,
+		Intermediates: intermediates,
+	})
+	return err
+}
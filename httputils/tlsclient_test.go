@@ -0,0 +1,259 @@
+package httputils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a leaf signed by the CA, the names parsing as IPs are IP SANs
+func (ca *testCA) issue(t *testing.T, commonName string, names ...string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	var dnsNames []string
+	var ipAddresses []net.IP
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			ipAddresses = append(ipAddresses, ip)
+		} else {
+			dnsNames = append(dnsNames, name)
+		}
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     dnsNames,
+		IPAddresses:  ipAddresses,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// newTestMTLSServer returns a server trusting the client certificates of clientCA and echoing their common name,
+// its certificate is valid for the given names, localhost by default
+func newTestMTLSServer(t *testing.T, serverCA, clientCA *testCA, names ...string) *httptest.Server {
+	if len(names) == 0 {
+		names = []string{"localhost"}
+	}
+	certPEM, keyPEM := serverCA.issue(t, "server", names...)
+	serverCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA.cert)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	// the rejected handshakes are expected
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	return server
+}
+
+func writeTestFile(t *testing.T, path string, content []byte, modTime time.Time) {
+	require.NoError(t, os.WriteFile(path, content, 0600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func getBody(httpClient IHttpClient, url string) (string, error) {
+	resp, err := HttpGet(httpClient, url, nil)
+	if err != nil {
+		return "", err
+	}
+	return HttpRespToString(resp)
+}
+
+func TestNewTLSClientInline(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	server := newTestMTLSServer(t, serverCA, clientCA)
+	defer server.Close()
+
+	certPEM, keyPEM := clientCA.issue(t, "agent")
+	httpClient, err := NewTLSClient(TLSClientConfig{
+		CAPEM:      serverCA.pem,
+		CertPEM:    certPEM,
+		KeyPEM:     keyPEM,
+		ServerName: "localhost",
+		MinVersion: tls.VersionTLS13,
+	})
+	require.NoError(t, err)
+	body, err := getBody(httpClient, server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "agent", body)
+
+	t.Run("untrusted server", func(t *testing.T) {
+		httpClient, err := NewTLSClient(TLSClientConfig{CAPEM: clientCA.pem, CertPEM: certPEM, KeyPEM: keyPEM, ServerName: "localhost"})
+		require.NoError(t, err)
+		_, err = getBody(httpClient, server.URL)
+		assert.Error(t, err)
+	})
+
+	t.Run("wrong server name", func(t *testing.T) {
+		httpClient, err := NewTLSClient(TLSClientConfig{CAPEM: serverCA.pem, CertPEM: certPEM, KeyPEM: keyPEM, ServerName: "other"})
+		require.NoError(t, err)
+		_, err = getBody(httpClient, server.URL)
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid pem", func(t *testing.T) {
+		_, err := NewTLSClient(TLSClientConfig{CAPEM: []byte("not a pem")})
+		assert.Error(t, err)
+		_, err = NewTLSClient(TLSClientConfig{CertPEM: certPEM, KeyPEM: serverCA.pem})
+		assert.Error(t, err)
+	})
+}
+
+func TestNewTLSClientReload(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	server := newTestMTLSServer(t, serverCA, clientCA)
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	modTime := time.Now().Add(-time.Hour)
+	// the first CA file does not trust the server yet
+	writeTestFile(t, caFile, clientCA.pem, modTime)
+	certPEM, keyPEM := clientCA.issue(t, "agent-1")
+	writeTestFile(t, certFile, certPEM, modTime)
+	writeTestFile(t, keyFile, keyPEM, modTime)
+
+	tlsConfig, reloader, err := newTLSConfig(TLSClientConfig{
+		CAFile:     caFile,
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		ServerName: "localhost",
+	})
+	require.NoError(t, err)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.DisableKeepAlives = true
+	httpClient := &http.Client{Transport: transport}
+
+	_, err = getBody(httpClient, server.URL)
+	assert.Error(t, err)
+
+	// rotation within the reload interval is not picked up
+	modTime = modTime.Add(time.Minute)
+	writeTestFile(t, caFile, serverCA.pem, modTime)
+	_, err = getBody(httpClient, server.URL)
+	assert.Error(t, err)
+
+	setReloaderClock := func(now time.Time) {
+		reloader.mutex.Lock()
+		reloader.now = func() time.Time { return now }
+		reloader.mutex.Unlock()
+	}
+	setReloaderClock(time.Now().Add(2 * DefaultCertReloadInterval))
+	body, err := getBody(httpClient, server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "agent-1", body)
+
+	certPEM, keyPEM = clientCA.issue(t, "agent-2")
+	modTime = modTime.Add(time.Minute)
+	writeTestFile(t, certFile, certPEM, modTime)
+	writeTestFile(t, keyFile, keyPEM, modTime)
+	setReloaderClock(time.Now().Add(4 * DefaultCertReloadInterval))
+	body, err = getBody(httpClient, server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "agent-2", body)
+
+	t.Run("failed reload keeps the previous certificate", func(t *testing.T) {
+		modTime = modTime.Add(time.Minute)
+		writeTestFile(t, keyFile, []byte("garbage"), modTime)
+		setReloaderClock(time.Now().Add(6 * DefaultCertReloadInterval))
+		body, err := getBody(httpClient, server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, "agent-2", body)
+	})
+}
+
+func TestNewTLSClientReloadIPAddress(t *testing.T) {
+	serverCA := newTestCA(t, "server-ca")
+	clientCA := newTestCA(t, "client-ca")
+	server := newTestMTLSServer(t, serverCA, clientCA, "127.0.0.1")
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	writeTestFile(t, caFile, serverCA.pem, time.Now())
+	certPEM, keyPEM := clientCA.issue(t, "agent")
+
+	httpClient, err := NewTLSClient(TLSClientConfig{CAFile: caFile, CertPEM: certPEM, KeyPEM: keyPEM, ServerName: "127.0.0.1"})
+	require.NoError(t, err)
+	body, err := getBody(httpClient, server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "agent", body)
+
+	t.Run("ip not in the certificate", func(t *testing.T) {
+		httpClient, err := NewTLSClient(TLSClientConfig{CAFile: caFile, CertPEM: certPEM, KeyPEM: keyPEM, ServerName: "127.0.0.2"})
+		require.NoError(t, err)
+		_, err = getBody(httpClient, server.URL)
+		assert.Error(t, err)
+	})
+
+	t.Run("missing server name", func(t *testing.T) {
+		httpClient, err := NewTLSClient(TLSClientConfig{CAFile: caFile, CertPEM: certPEM, KeyPEM: keyPEM})
+		require.NoError(t, err)
+		_, err = getBody(httpClient, server.URL)
+		assert.ErrorContains(t, err, "set ServerName")
+	})
+}
@@ -0,0 +1,138 @@
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// ChunkUploadConfig configures UploadChunks
+type ChunkUploadConfig[T any] struct {
+	// URL is the URL every chunk is posted to
+	URL string
+	// Headers are set on every request
+	Headers map[string]string
+	// Marshal encodes a chunk into a request body, nil means json.Marshal
+	Marshal func(chunk []T) ([]byte, error)
+	// Concurrency is the number of chunks uploaded in parallel, values below 1 mean 1
+	Concurrency int
+	// RetryPolicy is the retry policy of every chunk upload, nil means DefaultRetryPolicy
+	RetryPolicy *RetryPolicy
+}
+
+// ChunkFailure describes a chunk that could not be uploaded
+type ChunkFailure struct {
+	// Index is the position of the chunk in the chunks channel
+	Index int
+	// Length is the number of elements in the chunk
+	Length int
+	// Err is the reason of the failure
+	Err error
+}
+
+// UploadResult is the outcome of UploadChunks
+type UploadResult struct {
+	// Chunks is the number of chunks received from the channel
+	Chunks int
+	// Elements is the number of elements received from the channel
+	Elements int
+	// Failed lists the chunks that were not uploaded, ordered by index
+	Failed []ChunkFailure
+}
+
+// Err returns the errors of all the failed chunks joined together, or nil if all the chunks were uploaded
+func (r *UploadResult) Err() error {
+	errs := make([]error, 0, len(r.Failed))
+	for _, f := range r.Failed {
+		errs = append(errs, fmt.Errorf("chunk %d: %w", f.Index, f.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// UploadChunks posts every chunk received from the chunks channel (e.g. the output of SplitSlice2Chunks)
+// using up to config.Concurrency parallel requests and returns once the channel is closed
+// when ctx is done the remaining chunks are still drained from the channel, so the producer is never blocked,
+// and are reported as failed with the context error
+func UploadChunks[T any](ctx context.Context, httpClient IHttpClient, chunks <-chan []T, config ChunkUploadConfig[T]) *UploadResult {
+	marshal := config.Marshal
+	if marshal == nil {
+		marshal = func(chunk []T) ([]byte, error) {
+			return json.Marshal(chunk)
+		}
+	}
+	concurrency := config.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	result := &UploadResult{}
+	mutex := sync.Mutex{}
+	addFailure := func(index, length int, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		result.Failed = append(result.Failed, ChunkFailure{Index: index, Length: length, Err: err})
+	}
+
+	type indexedChunk struct {
+		index int
+		chunk []T
+	}
+	jobs := make(chan indexedChunk)
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if err := uploadChunk(ctx, httpClient, job.chunk, marshal, config); err != nil {
+					addFailure(job.index, len(job.chunk), err)
+				}
+			}
+		}()
+	}
+
+	for chunk := range chunks {
+		index := result.Chunks
+		result.Chunks++
+		result.Elements += len(chunk)
+		if ctx.Err() != nil {
+			addFailure(index, len(chunk), ctx.Err())
+			continue
+		}
+		select {
+		case jobs <- indexedChunk{index: index, chunk: chunk}:
+		case <-ctx.Done():
+			addFailure(index, len(chunk), ctx.Err())
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(result.Failed, func(i, j int) bool {
+		return result.Failed[i].Index < result.Failed[j].Index
+	})
+	return result
+}
+
+func uploadChunk[T any](ctx context.Context, httpClient IHttpClient, chunk []T, marshal func(chunk []T) ([]byte, error), config ChunkUploadConfig[T]) error {
+	body, err := marshal(chunk)
+	if err != nil {
+		return fmt.Errorf("failed to encode chunk: %w", err)
+	}
+	resp, err := HttpPostWithPolicy(ctx, httpClient, config.URL, config.Headers, body, config.RetryPolicy)
+	if err != nil {
+		return err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return httpErrorFromResponse(nil, resp)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
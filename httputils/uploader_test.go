@@ -0,0 +1,132 @@
+package httputils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadChunks(t *testing.T) {
+	type testStruct struct {
+		Name string `json:"name"`
+	}
+	var slice []testStruct
+	for i := 0; i < 100; i++ {
+		slice = append(slice, testStruct{Name: fmt.Sprintf("CVE-2022-%04d", i)})
+	}
+
+	t.Run("all chunks are uploaded", func(t *testing.T) {
+		var inFlight, maxInFlight int32
+		received := map[string]bool{}
+		mutex := sync.Mutex{}
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				current := atomic.AddInt32(&inFlight, 1)
+				defer atomic.AddInt32(&inFlight, -1)
+				for {
+					observed := atomic.LoadInt32(&maxInFlight)
+					if current <= observed || atomic.CompareAndSwapInt32(&maxInFlight, observed, current) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+
+				var chunk []testStruct
+				assert.NoError(t, json.NewDecoder(req.Body).Decode(&chunk))
+				assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+				mutex.Lock()
+				for _, v := range chunk {
+					received[v.Name] = true
+				}
+				mutex.Unlock()
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			},
+		}
+
+		chunks, _ := SplitSlice2Chunks(slice, 200, 10)
+		result := UploadChunks(context.Background(), httpClient, chunks, ChunkUploadConfig[testStruct]{
+			URL:         "http://example.com",
+			Headers:     map[string]string{"Content-Type": "application/json"},
+			Concurrency: 3,
+		})
+
+		assert.NoError(t, result.Err())
+		assert.Empty(t, result.Failed)
+		assert.Equal(t, len(slice), result.Elements)
+		assert.Equal(t, len(slice), len(received))
+		assert.LessOrEqual(t, maxInFlight, int32(3))
+	})
+
+	t.Run("failed chunks are reported", func(t *testing.T) {
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				var chunk []testStruct
+				_ = json.NewDecoder(req.Body).Decode(&chunk)
+				if chunk[0].Name == "CVE-2022-0002" {
+					return &http.Response{StatusCode: http.StatusBadRequest, Body: http.NoBody}, nil
+				}
+				return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+			},
+		}
+
+		chunks := make(chan []testStruct, 4)
+		for i := 0; i < 4; i++ {
+			chunks <- slice[i : i+1]
+		}
+		close(chunks)
+		result := UploadChunks(context.Background(), httpClient, chunks, ChunkUploadConfig[testStruct]{
+			URL:         "http://example.com",
+			Concurrency: 2,
+			RetryPolicy: NoRetryPolicy(),
+		})
+
+		assert.Equal(t, 4, result.Chunks)
+		assert.Len(t, result.Failed, 1)
+		assert.Equal(t, 2, result.Failed[0].Index)
+		assert.Equal(t, 1, result.Failed[0].Length)
+		assert.ErrorContains(t, result.Err(), "chunk 2: http-error: '400 Bad Request'")
+	})
+
+	t.Run("marshal errors are reported", func(t *testing.T) {
+		chunks := make(chan []testStruct, 1)
+		chunks <- slice[:1]
+		close(chunks)
+		result := UploadChunks(context.Background(), &mockHttpClient{}, chunks, ChunkUploadConfig[testStruct]{
+			URL: "http://example.com",
+			Marshal: func(chunk []testStruct) ([]byte, error) {
+				return nil, fmt.Errorf("unsupported")
+			},
+		})
+
+		assert.Len(t, result.Failed, 1)
+		assert.True(t, strings.Contains(result.Err().Error(), "failed to encode chunk: unsupported"))
+	})
+
+	t.Run("context cancellation drains the channel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		httpClient := &mockHttpClient{
+			doFunc: func(req *http.Request) (*http.Response, error) {
+				cancel()
+				return nil, req.Context().Err()
+			},
+		}
+
+		chunks, _ := SplitSlice2Chunks(slice, 200, 0)
+		result := UploadChunks(ctx, httpClient, chunks, ChunkUploadConfig[testStruct]{
+			URL:         "http://example.com",
+			RetryPolicy: NoRetryPolicy(),
+		})
+
+		assert.Equal(t, len(slice), result.Elements)
+		assert.Len(t, result.Failed, result.Chunks)
+		assert.ErrorIs(t, result.Failed[len(result.Failed)-1].Err, context.Canceled)
+	})
+}